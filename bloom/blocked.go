@@ -0,0 +1,106 @@
+package bloom
+
+import (
+	"math"
+	"math/bits"
+)
+
+const blockWords = BlockBits / 64
+
+// Blocked is a Bloom filter in which every probe for a key falls within a
+// single 64-byte block, so a lookup touches one cache line instead of K.  It
+// needs somewhat more space than Filter for the same error; BlockedParamsM
+// accounts for this when sizing.
+//
+// Construct a filter with NewBlocked.  It is not safe for concurrent
+// mutation.
+type Blocked struct {
+	keys   uint
+	blocks uint64
+	words  []uint64
+}
+
+// NewBlocked returns a filter sized by BlockedParamsM to hold N items with
+// false-positive probability P.
+func NewBlocked(N uint64, P float64) *Blocked {
+	if N == 0 {
+		N = 1
+	}
+	if P <= 0 || P >= 1 {
+		panic("bloom: false-positive probability must be in (0, 1)")
+	}
+	M := BlockedParamsM(float64(N), P)
+	blocks := uint64(math.Ceil(M / BlockBits))
+	return &Blocked{
+		keys:   uint(math.Ceil(KeysForProbability(P))),
+		blocks: blocks,
+		words:  make([]uint64, blocks*blockWords),
+	}
+}
+
+func (b *Blocked) Add(key string) {
+	b.AddHash(Hash(key))
+}
+
+func (b *Blocked) AddHash(h uint64) {
+	block, x := b.locate(h)
+	for i := uint(0); i < b.keys; i++ {
+		var bit uint64
+		bit, x = probe(x, i)
+		block[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (b *Blocked) MayContain(key string) bool {
+	return b.MayContainHash(Hash(key))
+}
+
+func (b *Blocked) MayContainHash(h uint64) bool {
+	block, x := b.locate(h)
+	for i := uint(0); i < b.keys; i++ {
+		var bit uint64
+		bit, x = probe(x, i)
+		if block[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// FalsePositiveRate estimates the probability that MayContain returns true
+// for a key that was never added, averaged over the fill of every block.
+func (b *Blocked) FalsePositiveRate() float64 {
+	P := 0.0
+	for i := uint64(0); i < b.blocks; i++ {
+		X := 0
+		for _, w := range b.words[i*blockWords : (i+1)*blockWords] {
+			X += bits.OnesCount64(w)
+		}
+		P += math.Pow(float64(X)/BlockBits, float64(b.keys))
+	}
+	return P / float64(b.blocks)
+}
+
+func (b *Blocked) Keys() uint {
+	return b.keys
+}
+
+func (b *Blocked) Bits() uint64 {
+	return b.blocks * BlockBits
+}
+
+func (b *Blocked) locate(h uint64) ([]uint64, uint64) {
+	i := h % b.blocks
+	return b.words[i*blockWords : (i+1)*blockWords], fmix64(h)
+}
+
+// probe takes the i-th bit within a block from the next nine bits of x,
+// remixing once x is used up.  Double hashing is not used here because its
+// arithmetic progressions overlap badly within a block this small, which
+// pushes the error well above BlockedParamsP.
+func probe(x uint64, i uint) (uint64, uint64) {
+	if i > 0 && i%7 == 0 {
+		x = fmix64(x)
+	}
+	return x % BlockBits, x>>9 | x<<55
+}
@@ -19,3 +19,47 @@ func BloomParamsM(N float64, P float64) float64 {
 func BloomParamsP(N float64, M float64) float64 {
 	return math.Pow(math.E, 0-ln2_2*M/N)
 }
+
+// BlockBits is the size of one block of a Blocked filter:  a 64-byte cache
+// line.
+const BlockBits = 512
+
+// BlockedParamsP computes the false-positive probability of a blocked Bloom
+// filter of M bits holding N items with K probes per key.  Keys land in blocks
+// with a Poisson distribution, so the error is the classic error of a
+// BlockBits-sized filter averaged over the load of each block (Putze, Sanders,
+// and Singler).
+func BlockedParamsP(N float64, M float64, K float64) float64 {
+	blocks := math.Max(1, M/BlockBits)
+	lambda := N / blocks
+	limit := lambda + 10*math.Sqrt(lambda) + 10
+	P := 0.0
+	for i := 0.0; i <= limit; i++ {
+		lg, _ := math.Lgamma(i + 1)
+		pmf := math.Exp(0 - lambda + i*math.Log(lambda) - lg)
+		P += pmf * math.Pow(1-math.Pow(1-1/float64(BlockBits), i*K), K)
+	}
+	return P
+}
+
+// BlockedParamsM computes the bits a blocked Bloom filter needs to hold N
+// items with false-positive probability P when using KeysForProbability(P)
+// probes.  Blocking costs space, so the result exceeds BloomParamsM(N, P).
+func BlockedParamsM(N float64, P float64) float64 {
+	K := math.Ceil(KeysForProbability(P))
+	lo := BloomParamsM(N, P)
+	hi := lo
+	for BlockedParamsP(N, hi, K) > P {
+		lo = hi
+		hi *= 2
+	}
+	for hi-lo > BlockBits {
+		mid := (lo + hi) / 2
+		if BlockedParamsP(N, mid, K) > P {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hi
+}
@@ -1,11 +1,16 @@
 package bloom_test
 
 import (
+	"bytes"
+	"fmt"
+	"math"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
 	"hack.systems/util/bloom"
+	"hack.systems/util/envelope"
 )
 
 func TestBloom(t *testing.T) {
@@ -31,3 +36,195 @@ func TestBloom(t *testing.T) {
 		require.InEpsilon(param.P, p, 0.01)
 	}
 }
+
+func TestFilter(t *testing.T) {
+	require := require.New(t)
+
+	f := bloom.New(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		f.Add(fmt.Sprintf("key-%d", i))
+	}
+	for i := 0; i < 10000; i++ {
+		require.True(f.MayContain(fmt.Sprintf("key-%d", i)))
+	}
+	fp := 0
+	for i := 0; i < 100000; i++ {
+		if f.MayContain(fmt.Sprintf("absent-%d", i)) {
+			fp++
+		}
+	}
+	require.InDelta(0.01, float64(fp)/100000, 0.005)
+	require.InEpsilon(10000, f.EstimateCardinality(), 0.05)
+	require.InDelta(0.01, f.FalsePositiveRate(), 0.005)
+}
+
+func TestFilterUnionIntersect(t *testing.T) {
+	require := require.New(t)
+
+	a := bloom.New(1000, 0.01)
+	b := bloom.New(1000, 0.01)
+	a.Add("a")
+	a.Add("both")
+	b.Add("b")
+	b.Add("both")
+	u := bloom.New(1000, 0.01)
+	require.NoError(u.Union(a))
+	require.NoError(u.Union(b))
+	require.True(u.MayContain("a"))
+	require.True(u.MayContain("b"))
+	require.True(u.MayContain("both"))
+	require.NoError(a.Intersect(b))
+	require.True(a.MayContain("both"))
+	require.False(a.MayContain("a"))
+	require.Equal(bloom.Incompatible, a.Union(bloom.New(10, 0.1)))
+}
+
+func TestConcurrent(t *testing.T) {
+	require := require.New(t)
+
+	c := bloom.NewConcurrent(80000, 0.01)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 10000; i++ {
+				c.Add(fmt.Sprintf("key-%d-%d", g, i))
+			}
+		}(g)
+	}
+	wg.Wait()
+	for g := 0; g < 8; g++ {
+		for i := 0; i < 10000; i++ {
+			require.True(c.MayContain(fmt.Sprintf("key-%d-%d", g, i)))
+		}
+	}
+	require.InEpsilon(80000, c.EstimateCardinality(), 0.05)
+	s := c.Snapshot()
+	require.True(s.MayContain("key-3-42"))
+	require.Equal(c.FalsePositiveRate(), s.FalsePositiveRate())
+}
+
+func TestFilterEncoding(t *testing.T) {
+	require := require.New(t)
+
+	f := bloom.New(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add(fmt.Sprintf("key-%d", i))
+	}
+	data, err := f.MarshalBinary()
+	require.NoError(err)
+	g := &bloom.Filter{}
+	require.NoError(g.UnmarshalBinary(data))
+	require.Equal(f, g)
+
+	c := &bloom.Concurrent{}
+	require.NoError(c.UnmarshalBinary(data))
+	require.True(c.MayContain("key-42"))
+	buf := &bytes.Buffer{}
+	_, err = c.WriteTo(buf)
+	require.NoError(err)
+	require.Equal(data, buf.Bytes())
+
+	data[len(data)/2] ^= 0x80
+	require.Equal(envelope.BadChecksum, g.UnmarshalBinary(data))
+}
+
+func TestCounting(t *testing.T) {
+	require := require.New(t)
+
+	for _, width := range []uint{4, 8, 16} {
+		c := bloom.NewCounting(1000, 0.01, width)
+		for i := 0; i < 1000; i++ {
+			c.Add(fmt.Sprintf("key-%d", i))
+		}
+		c.Add("key-0")
+		require.True(c.Count("key-0") >= 2)
+		for i := 0; i < 1000; i += 2 {
+			require.True(c.Remove(fmt.Sprintf("key-%d", i)))
+		}
+		for i := 1; i < 1000; i += 2 {
+			require.True(c.MayContain(fmt.Sprintf("key-%d", i)))
+		}
+		require.True(c.MayContain("key-0"))
+		require.True(c.Remove("key-0"))
+		removed := 0
+		for i := 2; i < 1000; i += 2 {
+			if !c.MayContain(fmt.Sprintf("key-%d", i)) {
+				removed++
+			}
+		}
+		require.True(removed > 450)
+	}
+}
+
+func TestCountingSaturation(t *testing.T) {
+	require := require.New(t)
+
+	c := bloom.NewCounting(100, 0.01, 4)
+	for i := 0; i < 20; i++ {
+		c.Add("hot")
+	}
+	require.Equal(uint64(15), c.Count("hot"))
+	require.NotZero(c.Saturated())
+	for i := 0; i < 20; i++ {
+		require.True(c.Remove("hot"))
+	}
+	require.Equal(uint64(15), c.Count("hot"))
+	require.False(c.Remove("cold"))
+}
+
+func TestScalable(t *testing.T) {
+	require := require.New(t)
+
+	s := bloom.NewScalable(1000, 0.01, bloom.DefaultGrowth, bloom.DefaultTightening)
+	for i := 0; i < 50000; i++ {
+		s.Add(fmt.Sprintf("key-%d", i))
+	}
+	require.True(s.Stages() > 1)
+	for i := 0; i < 50000; i++ {
+		require.True(s.MayContain(fmt.Sprintf("key-%d", i)))
+	}
+	fp := 0
+	for i := 0; i < 100000; i++ {
+		if s.MayContain(fmt.Sprintf("absent-%d", i)) {
+			fp++
+		}
+	}
+	require.True(float64(fp)/100000 < 0.01)
+	require.True(s.FalsePositiveRate() < 0.01)
+	require.InEpsilon(50000, s.EstimateCardinality(), 0.05)
+}
+
+func TestBlockedParams(t *testing.T) {
+	require := require.New(t)
+
+	for _, P := range []float64{0.1, 0.01, 0.001} {
+		N := 1e6
+		K := math.Ceil(bloom.KeysForProbability(P))
+		M := bloom.BlockedParamsM(N, P)
+		require.True(M > bloom.BloomParamsM(N, P))
+		require.True(bloom.BlockedParamsP(N, M, K) <= P)
+		require.InEpsilon(P, bloom.BlockedParamsP(N, M, K), 0.05)
+	}
+}
+
+func TestBlocked(t *testing.T) {
+	require := require.New(t)
+
+	b := bloom.NewBlocked(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		b.Add(fmt.Sprintf("key-%d", i))
+	}
+	for i := 0; i < 10000; i++ {
+		require.True(b.MayContain(fmt.Sprintf("key-%d", i)))
+	}
+	fp := 0
+	for i := 0; i < 100000; i++ {
+		if b.MayContain(fmt.Sprintf("absent-%d", i)) {
+			fp++
+		}
+	}
+	require.InDelta(0.01, float64(fp)/100000, 0.005)
+	require.InDelta(0.01, b.FalsePositiveRate(), 0.005)
+}
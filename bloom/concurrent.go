@@ -0,0 +1,109 @@
+package bloom
+
+import (
+	"math/bits"
+	"sync/atomic"
+)
+
+// Concurrent is a Bloom filter that many goroutines may Add to and query
+// simultaneously without holding a lock.  Bits are set with a compare-and-swap
+// on the containing word, so an Add is visible to every MayContain that
+// starts after it returns.
+//
+// Construct a filter with NewConcurrent.
+type Concurrent struct {
+	keys  uint
+	bits  uint64
+	words []uint64
+}
+
+func NewConcurrent(N uint64, P float64) *Concurrent {
+	M, K := params(N, P)
+	return &Concurrent{
+		keys:  K,
+		bits:  M,
+		words: make([]uint64, M/64),
+	}
+}
+
+func (c *Concurrent) Add(key string) {
+	c.AddHash(Hash(key))
+}
+
+func (c *Concurrent) AddHash(h uint64) {
+	h1, h2 := Derive(h)
+	for i := uint(0); i < c.keys; i++ {
+		bit := (h1 + uint64(i)*h2) % c.bits
+		setBit(&c.words[bit/64], 1<<(bit%64))
+	}
+}
+
+func (c *Concurrent) MayContain(key string) bool {
+	return c.MayContainHash(Hash(key))
+}
+
+func (c *Concurrent) MayContainHash(h uint64) bool {
+	h1, h2 := Derive(h)
+	for i := uint(0); i < c.keys; i++ {
+		bit := (h1 + uint64(i)*h2) % c.bits
+		if atomic.LoadUint64(&c.words[bit/64])&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Concurrent) EstimateCardinality() float64 {
+	return estimateCardinality(c.popcount(), c.bits, c.keys)
+}
+
+func (c *Concurrent) FalsePositiveRate() float64 {
+	return falsePositiveRate(c.popcount(), c.bits, c.keys)
+}
+
+func (c *Concurrent) Keys() uint {
+	return c.keys
+}
+
+func (c *Concurrent) Bits() uint64 {
+	return c.bits
+}
+
+// Clear empties the filter.  Adds that race with Clear may or may not
+// survive it.
+func (c *Concurrent) Clear() {
+	for i := range c.words {
+		atomic.StoreUint64(&c.words[i], 0)
+	}
+}
+
+// Snapshot copies the filter into a plain Filter.  Adds that race with the
+// snapshot may or may not be reflected in it.
+func (c *Concurrent) Snapshot() *Filter {
+	f := &Filter{
+		keys:  c.keys,
+		bits:  c.bits,
+		words: make([]uint64, len(c.words)),
+	}
+	for i := range c.words {
+		f.words[i] = atomic.LoadUint64(&c.words[i])
+	}
+	return f
+}
+
+func (c *Concurrent) popcount() uint64 {
+	X := uint64(0)
+	for i := range c.words {
+		X += uint64(bits.OnesCount64(atomic.LoadUint64(&c.words[i])))
+	}
+	return X
+}
+
+func setBit(p *uint64, mask uint64) {
+	for {
+		value := atomic.LoadUint64(p)
+		if value&mask != 0 || atomic.CompareAndSwapUint64(p, value, value|mask) {
+			break
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package bloom
+
+// Counting is a Bloom filter that keeps a small counter in place of each bit
+// so that keys may be removed as well as added.  Counters are packed 4, 8, or
+// 16 bits wide into 64-bit words.
+//
+// A counter that reaches its maximum value saturates:  further adds leave it
+// there and removes no longer decrement it, because its true value is lost.
+// This keeps the filter free of false negatives at the cost of never fully
+// forgetting keys that collide on a saturated counter.
+//
+// Construct a filter with NewCounting.  It is not safe for concurrent use.
+type Counting struct {
+	keys  uint
+	width uint
+	slots uint64
+	words []uint64
+}
+
+// NewCounting returns a filter sized to hold N items with false-positive
+// probability P using counters width bits wide.  Width must be 4, 8, or 16.
+func NewCounting(N uint64, P float64, width uint) *Counting {
+	if width != 4 && width != 8 && width != 16 {
+		panic("bloom: counter width must be 4, 8, or 16")
+	}
+	M, K := params(N, P)
+	return &Counting{
+		keys:  K,
+		width: width,
+		slots: M,
+		words: make([]uint64, M*uint64(width)/64),
+	}
+}
+
+func (c *Counting) Add(key string) {
+	c.AddHash(Hash(key))
+}
+
+func (c *Counting) AddHash(h uint64) {
+	h1, h2 := Derive(h)
+	max := c.max()
+	for i := uint(0); i < c.keys; i++ {
+		slot := (h1 + uint64(i)*h2) % c.slots
+		if x := c.get(slot); x < max {
+			c.set(slot, x+1)
+		}
+	}
+}
+
+// Remove undoes one Add of key.  It returns false, and changes nothing, if
+// key is definitely not in the filter.  Removing a key that was never added
+// but tests as a false positive corrupts the filter, as with any counting
+// Bloom filter.
+func (c *Counting) Remove(key string) bool {
+	return c.RemoveHash(Hash(key))
+}
+
+func (c *Counting) RemoveHash(h uint64) bool {
+	if !c.MayContainHash(h) {
+		return false
+	}
+	h1, h2 := Derive(h)
+	max := c.max()
+	for i := uint(0); i < c.keys; i++ {
+		slot := (h1 + uint64(i)*h2) % c.slots
+		if x := c.get(slot); x < max {
+			c.set(slot, x-1)
+		}
+	}
+	return true
+}
+
+func (c *Counting) MayContain(key string) bool {
+	return c.MayContainHash(Hash(key))
+}
+
+func (c *Counting) MayContainHash(h uint64) bool {
+	return c.CountHash(h) > 0
+}
+
+// Count returns an upper bound on the number of times key was added and not
+// removed.  It is exact unless key collides with other keys on every probe.
+func (c *Counting) Count(key string) uint64 {
+	return c.CountHash(Hash(key))
+}
+
+func (c *Counting) CountHash(h uint64) uint64 {
+	h1, h2 := Derive(h)
+	count := c.max()
+	for i := uint(0); i < c.keys; i++ {
+		slot := (h1 + uint64(i)*h2) % c.slots
+		if x := c.get(slot); x < count {
+			count = x
+		}
+	}
+	return count
+}
+
+// Saturated returns the number of counters stuck at their maximum value.
+func (c *Counting) Saturated() uint64 {
+	max := c.max()
+	n := uint64(0)
+	for slot := uint64(0); slot < c.slots; slot++ {
+		if c.get(slot) == max {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *Counting) Keys() uint {
+	return c.keys
+}
+
+func (c *Counting) Slots() uint64 {
+	return c.slots
+}
+
+func (c *Counting) Width() uint {
+	return c.width
+}
+
+func (c *Counting) Bits() uint64 {
+	return c.slots * uint64(c.width)
+}
+
+func (c *Counting) max() uint64 {
+	return 1<<c.width - 1
+}
+
+func (c *Counting) get(slot uint64) uint64 {
+	per := 64 / uint64(c.width)
+	shift := (slot % per) * uint64(c.width)
+	return (c.words[slot/per] >> shift) & c.max()
+}
+
+func (c *Counting) set(slot, x uint64) {
+	per := 64 / uint64(c.width)
+	shift := (slot % per) * uint64(c.width)
+	w := &c.words[slot/per]
+	*w = *w&^(c.max()<<shift) | x<<shift
+}
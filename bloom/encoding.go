@@ -0,0 +1,102 @@
+package bloom
+
+import (
+	"bytes"
+	"io"
+
+	"hack.systems/util/envelope"
+)
+
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	_, err := f.WriteTo(buf)
+	return buf.Bytes(), err
+}
+
+func (f *Filter) UnmarshalBinary(data []byte) error {
+	_, err := f.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+func (f *Filter) WriteTo(w io.Writer) (int64, error) {
+	return writeWords(w, f.keys, f.bits, func(i int) uint64 {
+		return f.words[i]
+	})
+}
+
+// ReadFrom replaces f with the filter encoded in r.
+func (f *Filter) ReadFrom(r io.Reader) (int64, error) {
+	keys, bits, words, n, err := readWords(r)
+	if err != nil {
+		return n, err
+	}
+	f.keys = keys
+	f.bits = bits
+	f.words = words
+	return n, nil
+}
+
+// MarshalBinary encodes c in the same format as Filter.  Adds that race with
+// the encoding may or may not be reflected in it.
+func (c *Concurrent) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	_, err := c.WriteTo(buf)
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary replaces c with the encoded filter.  It must not race with
+// any other method on c.
+func (c *Concurrent) UnmarshalBinary(data []byte) error {
+	_, err := c.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+func (c *Concurrent) WriteTo(w io.Writer) (int64, error) {
+	return c.Snapshot().WriteTo(w)
+}
+
+func (c *Concurrent) ReadFrom(r io.Reader) (int64, error) {
+	keys, bits, words, n, err := readWords(r)
+	if err != nil {
+		return n, err
+	}
+	c.keys = keys
+	c.bits = bits
+	c.words = words
+	return n, nil
+}
+
+func writeWords(w io.Writer, keys uint, bits uint64, word func(int) uint64) (int64, error) {
+	nwords := bits / 64
+	e := envelope.NewEncoder(w, envelope.Header{
+		Kind:   envelope.KindBloom,
+		Hash:   envelope.HashFNV1a64,
+		Keys:   uint32(keys),
+		Width:  bits,
+		Length: nwords * 8,
+	})
+	for i := 0; i < int(nwords); i++ {
+		e.Uint64(word(i))
+	}
+	return e.Close()
+}
+
+func readWords(r io.Reader) (uint, uint64, []uint64, int64, error) {
+	d, h, err := envelope.NewDecoder(r)
+	if err == nil && (h.Kind != envelope.KindBloom || h.Hash != envelope.HashFNV1a64) {
+		err = envelope.WrongKind
+	}
+	if err == nil && (h.Keys == 0 || h.Width == 0 || h.Width%64 != 0 || h.Length != h.Width/8) {
+		err = envelope.BadLength
+	}
+	if err != nil {
+		n, err := d.Fail(err)
+		return 0, 0, nil, n, err
+	}
+	words := d.Uint64s(h.Width / 64)
+	n, err := d.Close()
+	if err != nil {
+		return 0, 0, nil, n, err
+	}
+	return uint(h.Keys), h.Width, words, n, nil
+}
@@ -0,0 +1,145 @@
+package bloom
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+var Incompatible = errors.New("bloom filters have different parameters")
+
+// Filter is a classic Bloom filter sized for an expected number of items and
+// a target false-positive rate.  It is not safe for concurrent mutation; see
+// Concurrent for that.
+//
+// Construct a filter with New.
+type Filter struct {
+	keys  uint
+	bits  uint64
+	words []uint64
+}
+
+// New returns a filter sized to hold N items with false-positive probability
+// P, using BloomParamsM and KeysForProbability to pick the parameters.
+func New(N uint64, P float64) *Filter {
+	M, K := params(N, P)
+	return &Filter{
+		keys:  K,
+		bits:  M,
+		words: make([]uint64, M/64),
+	}
+}
+
+func params(N uint64, P float64) (uint64, uint) {
+	if N == 0 {
+		N = 1
+	}
+	if P <= 0 || P >= 1 {
+		panic("bloom: false-positive probability must be in (0, 1)")
+	}
+	M := uint64(math.Ceil(BloomParamsM(float64(N), P)))
+	M = (M + 63) / 64 * 64
+	K := uint(math.Ceil(KeysForProbability(P)))
+	return M, K
+}
+
+func (f *Filter) Add(key string) {
+	f.AddHash(Hash(key))
+}
+
+func (f *Filter) AddHash(h uint64) {
+	h1, h2 := Derive(h)
+	for i := uint(0); i < f.keys; i++ {
+		bit := (h1 + uint64(i)*h2) % f.bits
+		f.words[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (f *Filter) MayContain(key string) bool {
+	return f.MayContainHash(Hash(key))
+}
+
+func (f *Filter) MayContainHash(h uint64) bool {
+	h1, h2 := Derive(h)
+	for i := uint(0); i < f.keys; i++ {
+		bit := (h1 + uint64(i)*h2) % f.bits
+		if f.words[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Union sets f to contain every key in either f or other.
+func (f *Filter) Union(other *Filter) error {
+	if !f.compatible(other) {
+		return Incompatible
+	}
+	for i := range f.words {
+		f.words[i] |= other.words[i]
+	}
+	return nil
+}
+
+// Intersect sets f to contain only the keys in both f and other.  The result
+// may report more false positives than a filter built from the intersection
+// directly would.
+func (f *Filter) Intersect(other *Filter) error {
+	if !f.compatible(other) {
+		return Incompatible
+	}
+	for i := range f.words {
+		f.words[i] &= other.words[i]
+	}
+	return nil
+}
+
+// EstimateCardinality approximates the number of distinct keys added to the
+// filter from the fraction of bits set (Swamidass & Baldi).
+func (f *Filter) EstimateCardinality() float64 {
+	return estimateCardinality(f.popcount(), f.bits, f.keys)
+}
+
+// FalsePositiveRate estimates the probability that MayContain returns true
+// for a key that was never added, given the bits set so far.
+func (f *Filter) FalsePositiveRate() float64 {
+	return falsePositiveRate(f.popcount(), f.bits, f.keys)
+}
+
+func (f *Filter) Keys() uint {
+	return f.keys
+}
+
+func (f *Filter) Bits() uint64 {
+	return f.bits
+}
+
+func (f *Filter) Clear() {
+	for i := range f.words {
+		f.words[i] = 0
+	}
+}
+
+func (f *Filter) compatible(other *Filter) bool {
+	return f.keys == other.keys && f.bits == other.bits
+}
+
+func (f *Filter) popcount() uint64 {
+	X := uint64(0)
+	for _, w := range f.words {
+		X += uint64(bits.OnesCount64(w))
+	}
+	return X
+}
+
+func estimateCardinality(X, M uint64, K uint) float64 {
+	if X >= M {
+		return math.Inf(1)
+	}
+	m := float64(M)
+	return 0 - m/float64(K)*math.Log(1-float64(X)/m)
+}
+
+func falsePositiveRate(X, M uint64, K uint) float64 {
+	return math.Pow(float64(X)/float64(M), float64(K))
+}
@@ -0,0 +1,36 @@
+package bloom
+
+const (
+	fnvOffset64 uint64 = 14695981039346656037
+	fnvPrime64  uint64 = 1099511628211
+)
+
+// Hash computes the 64-bit FNV-1a hash of key without allocating.  Every
+// structure in this package derives its probes from this one value, so a
+// caller may hash a key once and hand the result to the *Hash methods.
+func Hash(key string) uint64 {
+	h := fnvOffset64
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= fnvPrime64
+	}
+	return h
+}
+
+// Derive splits a single 64-bit hash into the two hashes used for
+// Kirsch-Mitzenmacher double hashing:  probe i is h1 + i*h2.  The second
+// hash is passed through a finalizer so that it is independent of h1, and
+// forced odd so that it never degenerates to a single probe.
+func Derive(h uint64) (uint64, uint64) {
+	return h, fmix64(h) | 1
+}
+
+// fmix64 is the MurmurHash3 finalizer.
+func fmix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
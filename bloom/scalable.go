@@ -0,0 +1,136 @@
+package bloom
+
+// Scalable is a Bloom filter that grows to hold an unbounded number of keys
+// while keeping its false-positive probability below a fixed bound.  It
+// chains ordinary filters, each larger than and with a tighter error bound
+// than the last, as described in "Scalable Bloom Filters" by Almeida, Baquero,
+// Preguiça, and Hutchison.
+//
+// With tightening ratio r, stage i targets P(1-r)r^i, and the compound
+// false-positive probability is bounded by the geometric sum P.
+//
+// Construct a filter with NewScalable.  It is not safe for concurrent use.
+type Scalable struct {
+	growth     uint64
+	tightening float64
+	capacity   uint64
+	target     float64
+	stages     []*stage
+}
+
+type stage struct {
+	filter   *Filter
+	capacity uint64
+	target   float64
+	added    uint64
+}
+
+const (
+	DefaultGrowth     = 2
+	DefaultTightening = 0.8
+)
+
+// NewScalable returns a filter whose first stage holds N items and whose
+// overall false-positive probability stays below P.  Each subsequent stage
+// holds growth times as many items as the last, at tightening times the error.
+func NewScalable(N uint64, P float64, growth uint64, tightening float64) *Scalable {
+	if growth < 1 {
+		panic("bloom: growth must be at least 1")
+	}
+	if tightening <= 0 || tightening >= 1 {
+		panic("bloom: tightening ratio must be in (0, 1)")
+	}
+	if N == 0 {
+		N = 1
+	}
+	s := &Scalable{
+		growth:     growth,
+		tightening: tightening,
+		capacity:   N,
+		target:     P * (1 - tightening),
+	}
+	s.grow()
+	return s
+}
+
+func (s *Scalable) Add(key string) {
+	s.AddHash(Hash(key))
+}
+
+func (s *Scalable) AddHash(h uint64) {
+	if s.MayContainHash(h) {
+		return
+	}
+	last := s.stages[len(s.stages)-1]
+	if last.full() {
+		s.grow()
+		last = s.stages[len(s.stages)-1]
+	}
+	last.filter.AddHash(h)
+	last.added++
+}
+
+func (s *Scalable) MayContain(key string) bool {
+	return s.MayContainHash(Hash(key))
+}
+
+func (s *Scalable) MayContainHash(h uint64) bool {
+	for i := len(s.stages) - 1; i >= 0; i-- {
+		if s.stages[i].filter.MayContainHash(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// EstimateCardinality sums the estimates of every stage.
+func (s *Scalable) EstimateCardinality() float64 {
+	n := float64(0)
+	for _, st := range s.stages {
+		n += st.filter.EstimateCardinality()
+	}
+	return n
+}
+
+// FalsePositiveRate compounds the current estimate of every stage.
+func (s *Scalable) FalsePositiveRate() float64 {
+	p := float64(1)
+	for _, st := range s.stages {
+		p *= 1 - st.filter.FalsePositiveRate()
+	}
+	return 1 - p
+}
+
+func (s *Scalable) Stages() int {
+	return len(s.stages)
+}
+
+// Bits returns the total size of all stages.
+func (s *Scalable) Bits() uint64 {
+	M := uint64(0)
+	for _, st := range s.stages {
+		M += st.filter.Bits()
+	}
+	return M
+}
+
+func (s *Scalable) grow() {
+	N := s.capacity
+	P := s.target
+	for i := 0; i < len(s.stages); i++ {
+		N *= s.growth
+		P *= s.tightening
+	}
+	s.stages = append(s.stages, &stage{
+		filter:   New(N, P),
+		capacity: N,
+		target:   P,
+	})
+}
+
+// full reports whether another key would push the stage past its error
+// target, judged by the number of distinct keys it has absorbed.
+func (st *stage) full() bool {
+	return st.added >= st.capacity ||
+		BloomParamsP(float64(st.added+1), float64(st.filter.Bits())) > st.target
+}
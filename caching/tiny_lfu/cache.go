@@ -0,0 +1,378 @@
+package tiny_lfu
+
+import (
+	"container/list"
+	"errors"
+	"hash/maphash"
+	"sync"
+)
+
+var (
+	BadCapacity    = errors.New("tiny_lfu: cache capacity must be positive")
+	LoaderPanicked = errors.New("tiny_lfu: loader panicked")
+)
+
+// CacheConfig describes a Cache.  Only Capacity is required.
+type CacheConfig[K comparable, V any] struct {
+	// Capacity is the total weight the cache holds.
+	Capacity uint64
+	// Weigher returns the weight of an entry, e.g. its size in bytes.  The
+	// default weighs every entry 1, making Capacity a count of entries.
+	Weigher func(K, V) uint64
+	// Entries is the expected number of entries, used to size the sketch.
+	// It defaults to Capacity.
+	Entries uint64
+	// KeyHash hashes keys for the sketch.  The default is hash/maphash.
+	KeyHash func(K) uint64
+	// WindowFraction is the share of Capacity given to the admission window
+	// LRU.  The default is 0.01.
+	WindowFraction float64
+	// ProtectedFraction is the share of the main region given to its
+	// protected segment.  The default is 0.8.
+	ProtectedFraction float64
+	// Samples is the number of accesses after which the sketch halves its
+	// counts and clears its doorkeeper.  The default is 10*Entries.
+	Samples uint32
+	// SketchSpace bounds the bytes of the TinyLFU32 sketch.  The default is
+	// 64*Entries.
+	SketchSpace uint64
+	// SketchOptions are passed to New32 after the cache's own.
+	SketchOptions []Option
+	// DisableDoorkeeper sends every access straight to the sketch's counters
+	// instead of first filtering out keys seen only once.
+	DisableDoorkeeper bool
+}
+
+// Cache is a W-TinyLFU cache (Einziger, Friedman, and Manes).  New entries
+// enter a small LRU window.  Entries that fall out of the window compete
+// for a place in the main region, a segmented LRU, against its least
+// valuable entry; the one the TinyLFU sketch has seen more often wins.  A
+// doorkeeper Bloom filter keeps keys seen only once out of the sketch.
+//
+// Construct a cache with NewCache.  It is safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	mtx       sync.Mutex
+	sketch    *TinyLFU32
+	hash      func(K) uint64
+	weigher   func(K, V) uint64
+	capacity  uint64
+	window    segment
+	probation segment
+	protected segment
+	items     map[K]*list.Element
+	loads     map[K]*load[V]
+	stats     CacheStats
+}
+
+type CacheStats struct {
+	Hits       uint64
+	Misses     uint64
+	Evictions  uint64
+	Rejections uint64
+}
+
+type segment struct {
+	list     *list.List
+	weight   uint64
+	capacity uint64
+}
+
+type region int
+
+const (
+	inWindow region = iota
+	inProbation
+	inProtected
+)
+
+type entry[K comparable, V any] struct {
+	key    K
+	value  V
+	hash   uint64
+	weight uint64
+	region region
+}
+
+type load[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+	// stale is set when the key is set or deleted during the load, so that
+	// the loaded value does not overwrite the newer state
+	stale bool
+}
+
+func NewCache[K comparable, V any](config CacheConfig[K, V]) (*Cache[K, V], error) {
+	if config.Capacity == 0 {
+		return nil, BadCapacity
+	}
+	if config.Weigher == nil {
+		config.Weigher = func(K, V) uint64 { return 1 }
+	}
+	if config.Entries == 0 {
+		config.Entries = config.Capacity
+	}
+	if config.KeyHash == nil {
+		seed := maphash.MakeSeed()
+		config.KeyHash = func(k K) uint64 { return maphash.Comparable(seed, k) }
+	}
+	if config.WindowFraction <= 0 || config.WindowFraction >= 1 {
+		config.WindowFraction = 0.01
+	}
+	if config.ProtectedFraction <= 0 || config.ProtectedFraction >= 1 {
+		config.ProtectedFraction = 0.8
+	}
+	if config.Samples == 0 {
+		config.Samples = uint32(min(10*config.Entries, 1<<31))
+	}
+	if config.SketchSpace == 0 {
+		config.SketchSpace = 64 * config.Entries
+	}
+	var opts []Option
+	if !config.DisableDoorkeeper {
+		opts = append(opts, WithDoorkeeper(0.01))
+	}
+	opts = append(opts, config.SketchOptions...)
+	sketch, err := New32(config.Samples, config.SketchSpace, opts...)
+	if err != nil {
+		return nil, err
+	}
+	window := uint64(float64(config.Capacity) * config.WindowFraction)
+	if window == 0 {
+		window = 1
+	}
+	main := config.Capacity - min(window, config.Capacity)
+	protected := uint64(float64(main) * config.ProtectedFraction)
+	c := &Cache[K, V]{
+		sketch:    sketch,
+		hash:      config.KeyHash,
+		weigher:   config.Weigher,
+		capacity:  config.Capacity,
+		window:    segment{list: list.New(), capacity: window},
+		probation: segment{list: list.New(), capacity: main - protected},
+		protected: segment{list: list.New(), capacity: protected},
+		items:     make(map[K]*list.Element),
+		loads:     make(map[K]*load[V]),
+	}
+	return c, nil
+}
+
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	h := c.hash(key)
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.sketch.TallyHash(h)
+	elem, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		var zero V
+		return zero, false
+	}
+	c.stats.Hits++
+	c.touch(elem)
+	return elem.Value.(*entry[K, V]).value, true
+}
+
+// Set inserts or replaces the value for key.  An entry heavier than the
+// whole cache is not stored.  Nor is one heavier than the main region, the
+// capacity less the window: it is rejected as it leaves the window, which
+// is at once if it is heavier than the window too.
+func (c *Cache[K, V]) Set(key K, value V) {
+	h := c.hash(key)
+	w := c.weigher(key, value)
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.invalidate(key)
+	c.set(key, value, h, w)
+}
+
+func (c *Cache[K, V]) Delete(key K) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.invalidate(key)
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+}
+
+// GetOrLoad returns the cached value for key, or calls loader to produce
+// it and caches the result.  Concurrent calls for the same missing key share
+// one call to loader.  Errors are returned and not cached.  A value loaded
+// while the key is set or deleted is returned but not cached.  If loader or
+// the Weigher panics, the calls waiting on it return LoaderPanicked.
+func (c *Cache[K, V]) GetOrLoad(key K, loader func(K) (V, error)) (value V, err error) {
+	h := c.hash(key)
+	c.mtx.Lock()
+	c.sketch.TallyHash(h)
+	if elem, ok := c.items[key]; ok {
+		c.stats.Hits++
+		c.touch(elem)
+		value = elem.Value.(*entry[K, V]).value
+		c.mtx.Unlock()
+		return value, nil
+	}
+	c.stats.Misses++
+	if l, ok := c.loads[key]; ok {
+		c.mtx.Unlock()
+		<-l.done
+		return l.value, l.err
+	}
+	l := &load[V]{done: make(chan struct{})}
+	c.loads[key] = l
+	c.mtx.Unlock()
+
+	err = LoaderPanicked
+	var w uint64
+	defer func() {
+		c.mtx.Lock()
+		delete(c.loads, key)
+		if err == nil && !l.stale {
+			c.set(key, value, h, w)
+		}
+		c.mtx.Unlock()
+		l.value, l.err = value, err
+		close(l.done)
+	}()
+	v, lerr := loader(key)
+	if lerr == nil {
+		// weigh outside the lock, as Set does
+		w = c.weigher(key, v)
+	}
+	return v, lerr
+}
+
+func (c *Cache[K, V]) Len() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return len(c.items)
+}
+
+// Weight returns the total weight of the entries in the cache.
+func (c *Cache[K, V]) Weight() uint64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.window.weight + c.probation.weight + c.protected.weight
+}
+
+func (c *Cache[K, V]) Stats() CacheStats {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.stats
+}
+
+// invalidate marks any load of key in progress as stale.
+func (c *Cache[K, V]) invalidate(key K) {
+	if l, ok := c.loads[key]; ok {
+		l.stale = true
+	}
+}
+
+func (c *Cache[K, V]) set(key K, value V, h, w uint64) {
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+	if w > c.capacity {
+		return
+	}
+	e := &entry[K, V]{
+		key:    key,
+		value:  value,
+		hash:   h,
+		weight: w,
+		region: inWindow,
+	}
+	c.items[key] = c.window.pushFront(e, w)
+	c.evict()
+}
+
+// touch moves an accessed entry to the front of its segment, promoting it
+// from probation to protected.
+func (c *Cache[K, V]) touch(elem *list.Element) {
+	e := elem.Value.(*entry[K, V])
+	switch e.region {
+	case inWindow:
+		c.window.list.MoveToFront(elem)
+	case inProbation:
+		c.probation.remove(elem, e.weight)
+		e.region = inProtected
+		c.items[e.key] = c.protected.pushFront(e, e.weight)
+		for c.protected.weight > c.protected.capacity && c.protected.list.Len() > 1 {
+			demoted := c.protected.list.Back()
+			d := demoted.Value.(*entry[K, V])
+			c.protected.remove(demoted, d.weight)
+			d.region = inProbation
+			c.items[d.key] = c.probation.pushFront(d, d.weight)
+		}
+	case inProtected:
+		c.protected.list.MoveToFront(elem)
+	}
+}
+
+// evict moves entries that overflow the window into the main region, each
+// displacing main-region victims only if the sketch favors it over them.
+func (c *Cache[K, V]) evict() {
+	for c.window.weight > c.window.capacity {
+		elem := c.window.list.Back()
+		candidate := elem.Value.(*entry[K, V])
+		c.window.remove(elem, candidate.weight)
+		c.admit(candidate)
+	}
+}
+
+// admit moves candidate into the main region if the sketch favors it over
+// every entry it would displace.  The victims are chosen before any is
+// evicted, so that a rejected candidate leaves the main region as it was.
+func (c *Cache[K, V]) admit(candidate *entry[K, V]) {
+	mainCapacity := c.probation.capacity + c.protected.capacity
+	if candidate.weight > mainCapacity {
+		c.reject(candidate)
+		return
+	}
+	var victims []*list.Element
+	weight := c.probation.weight + c.protected.weight + candidate.weight
+	for _, s := range []*segment{&c.probation, &c.protected} {
+		for victim := s.list.Back(); victim != nil && weight > mainCapacity; victim = victim.Prev() {
+			v := victim.Value.(*entry[K, V])
+			if !c.sketch.ShouldReplaceHash(v.hash, candidate.hash) {
+				c.reject(candidate)
+				return
+			}
+			victims = append(victims, victim)
+			weight -= v.weight
+		}
+	}
+	for _, victim := range victims {
+		c.remove(victim)
+		c.stats.Evictions++
+	}
+	candidate.region = inProbation
+	c.items[candidate.key] = c.probation.pushFront(candidate, candidate.weight)
+}
+
+func (c *Cache[K, V]) reject(candidate *entry[K, V]) {
+	delete(c.items, candidate.key)
+	c.stats.Rejections++
+}
+
+func (c *Cache[K, V]) remove(elem *list.Element) {
+	e := elem.Value.(*entry[K, V])
+	switch e.region {
+	case inWindow:
+		c.window.remove(elem, e.weight)
+	case inProbation:
+		c.probation.remove(elem, e.weight)
+	case inProtected:
+		c.protected.remove(elem, e.weight)
+	}
+	delete(c.items, e.key)
+}
+
+func (s *segment) pushFront(e interface{}, w uint64) *list.Element {
+	s.weight += w
+	return s.list.PushFront(e)
+}
+
+func (s *segment) remove(elem *list.Element, w uint64) {
+	s.weight -= w
+	s.list.Remove(elem)
+}
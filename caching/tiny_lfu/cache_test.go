@@ -0,0 +1,275 @@
+package tiny_lfu_test
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"hack.systems/util/caching/tiny_lfu"
+)
+
+func TestCacheBasics(t *testing.T) {
+	require := require.New(t)
+
+	c, err := tiny_lfu.NewCache(tiny_lfu.CacheConfig[int, string]{Capacity: 100})
+	require.NoError(err)
+	_, ok := c.Get(1)
+	require.False(ok)
+	c.Set(1, "one")
+	v, ok := c.Get(1)
+	require.True(ok)
+	require.Equal("one", v)
+	c.Set(1, "uno")
+	v, _ = c.Get(1)
+	require.Equal("uno", v)
+	c.Delete(1)
+	_, ok = c.Get(1)
+	require.False(ok)
+	require.Equal(0, c.Len())
+
+	_, err = tiny_lfu.NewCache(tiny_lfu.CacheConfig[int, string]{})
+	require.Equal(tiny_lfu.BadCapacity, err)
+}
+
+func TestCacheBounded(t *testing.T) {
+	require := require.New(t)
+
+	c, err := tiny_lfu.NewCache(tiny_lfu.CacheConfig[string, []byte]{
+		Capacity: 1 << 20,
+		Entries:  1 << 10,
+		Weigher: func(k string, v []byte) uint64 {
+			return uint64(len(k) + len(v))
+		},
+	})
+	require.NoError(err)
+	for i := 0; i < 10000; i++ {
+		c.Set(fmt.Sprintf("key-%d", i), make([]byte, 1000+i%1000))
+		require.True(c.Weight() <= 1<<20)
+	}
+	c.Set("huge", make([]byte, 1<<21))
+	_, ok := c.Get("huge")
+	require.False(ok)
+}
+
+func TestCacheWeightedAdmission(t *testing.T) {
+	require := require.New(t)
+
+	c, err := tiny_lfu.NewCache(tiny_lfu.CacheConfig[int, uint64]{
+		Capacity: 1000,
+		Weigher: func(k int, v uint64) uint64 {
+			return v
+		},
+	})
+	require.NoError(err)
+	for i := 0; i < 500; i++ {
+		c.Set(i, 1)
+	}
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 500; i++ {
+			c.Get(i)
+		}
+	}
+	// popular, but heavier than the main region, so rejected without
+	// evicting anything
+	for i := 0; i < 20; i++ {
+		c.Get(1000)
+	}
+	c.Set(1000, 995)
+	_, ok := c.Get(1000)
+	require.False(ok)
+	require.Equal(500, c.Len())
+	require.Equal(tiny_lfu.CacheStats{Hits: 2500, Misses: 21, Rejections: 1}, c.Stats())
+
+	// loses to the first of the victims it would displace
+	c.Set(2000, 600)
+	require.Equal(500, c.Len())
+	require.Zero(c.Stats().Evictions)
+	require.Equal(uint64(2), c.Stats().Rejections)
+
+	// wins against all of them
+	for i := 0; i < 20; i++ {
+		c.Get(3000)
+	}
+	c.Set(3000, 600)
+	v, ok := c.Get(3000)
+	require.True(ok)
+	require.Equal(uint64(600), v)
+	require.True(c.Weight() <= 1000)
+	require.Equal(uint64(500-c.Len()+1), c.Stats().Evictions)
+}
+
+func TestCacheHeavierThanMain(t *testing.T) {
+	require := require.New(t)
+
+	// a window of 60 and a main region of 40
+	c, err := tiny_lfu.NewCache(tiny_lfu.CacheConfig[int, uint64]{
+		Capacity:       100,
+		WindowFraction: 0.6,
+		Weigher: func(k int, v uint64) uint64 {
+			return v
+		},
+	})
+	require.NoError(err)
+	// fits the cache and the window, so it is served from the window
+	c.Set(1, 50)
+	_, ok := c.Get(1)
+	require.True(ok)
+	// pushed from the window, it cannot enter the main region
+	c.Set(2, 20)
+	_, ok = c.Get(1)
+	require.False(ok)
+	require.Equal(uint64(20), c.Weight())
+	require.Equal(uint64(1), c.Stats().Rejections)
+	require.Zero(c.Stats().Evictions)
+	// heavier than the window too, it is rejected at once
+	c.Set(3, 70)
+	_, ok = c.Get(3)
+	require.False(ok)
+	require.Equal(uint64(2), c.Stats().Rejections)
+}
+
+func TestCacheScanResistance(t *testing.T) {
+	require := require.New(t)
+
+	c, err := tiny_lfu.NewCache(tiny_lfu.CacheConfig[int, int]{Capacity: 1000})
+	require.NoError(err)
+	for round := 0; round < 20; round++ {
+		for i := 0; i < 500; i++ {
+			if _, ok := c.Get(i); !ok {
+				c.Set(i, i)
+			}
+		}
+	}
+	for i := 1000; i < 100000; i++ {
+		if _, ok := c.Get(i); !ok {
+			c.Set(i, i)
+		}
+	}
+	hits := 0
+	for i := 0; i < 500; i++ {
+		if _, ok := c.Get(i); ok {
+			hits++
+		}
+	}
+	require.True(hits > 450)
+	require.NotZero(c.Stats().Rejections)
+}
+
+// loaded is what a call to GetOrLoad returned, sent back to the test from
+// another goroutine.
+type loaded struct {
+	value int
+	err   error
+}
+
+func TestCacheGetOrLoad(t *testing.T) {
+	require := require.New(t)
+
+	c, err := tiny_lfu.NewCache(tiny_lfu.CacheConfig[string, int]{Capacity: 100})
+	require.NoError(err)
+	var calls int32
+	release := make(chan struct{})
+	results := make(chan loaded, 10)
+	for i := 0; i < 10; i++ {
+		go func() {
+			v, err := c.GetOrLoad("key", func(string) (int, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return 42, nil
+			})
+			results <- loaded{v, err}
+		}()
+	}
+	for c.Stats().Misses < 10 {
+		runtime.Gosched()
+	}
+	close(release)
+	for i := 0; i < 10; i++ {
+		r := <-results
+		require.NoError(r.err)
+		require.Equal(42, r.value)
+	}
+	require.Equal(int32(1), calls)
+	v, ok := c.Get("key")
+	require.True(ok)
+	require.Equal(42, v)
+
+	boom := errors.New("boom")
+	_, err = c.GetOrLoad("fail", func(string) (int, error) {
+		return 0, boom
+	})
+	require.Equal(boom, err)
+	_, ok = c.Get("fail")
+	require.False(ok)
+}
+
+func TestCacheGetOrLoadPanic(t *testing.T) {
+	require := require.New(t)
+
+	c, err := tiny_lfu.NewCache(tiny_lfu.CacheConfig[string, int]{Capacity: 100})
+	require.NoError(err)
+	started := make(chan struct{})
+	waited := make(chan error)
+	go func() {
+		<-started
+		_, err := c.GetOrLoad("key", func(string) (int, error) {
+			return 0, nil
+		})
+		waited <- err
+	}()
+	require.Panics(func() {
+		c.GetOrLoad("key", func(string) (int, error) {
+			close(started)
+			for c.Stats().Misses < 2 {
+				runtime.Gosched()
+			}
+			panic("boom")
+		})
+	})
+	require.Equal(tiny_lfu.LoaderPanicked, <-waited)
+	v, err := c.GetOrLoad("key", func(string) (int, error) {
+		return 42, nil
+	})
+	require.NoError(err)
+	require.Equal(42, v)
+}
+
+func TestCacheGetOrLoadStale(t *testing.T) {
+	require := require.New(t)
+
+	c, err := tiny_lfu.NewCache(tiny_lfu.CacheConfig[string, int]{Capacity: 100})
+	require.NoError(err)
+	for _, set := range []bool{true, false} {
+		c.Delete("key")
+		started := make(chan struct{})
+		release := make(chan struct{})
+		results := make(chan loaded)
+		go func() {
+			v, err := c.GetOrLoad("key", func(string) (int, error) {
+				close(started)
+				<-release
+				return 42, nil
+			})
+			results <- loaded{v, err}
+		}()
+		<-started
+		if set {
+			c.Set("key", 7)
+		} else {
+			c.Delete("key")
+		}
+		close(release)
+		r := <-results
+		require.NoError(r.err)
+		require.Equal(42, r.value)
+		v, ok := c.Get("key")
+		require.Equal(set, ok)
+		if set {
+			require.Equal(7, v)
+		}
+	}
+}
@@ -1,5 +1,145 @@
 package tiny_lfu
 
+import (
+	"errors"
+	"math"
+
+	"hack.systems/util/bloom"
+)
+
 const (
 	minP float64 = 0.0625
+	// maxKeys bounds the probes per key; a false-positive floor of 2^-64 is
+	// well past useful.
+	maxKeys = 64
+)
+
+// Counters is the hash-keyed core of a sketch, over which TinyLFU[K] puts
+// keys of any type.
+type Counters interface {
+	TallyHash(key uint64)
+	// TallyNHash records n occurrences of key at once.
+	TallyNHash(key uint64, n uint64)
+	// EstimateHash returns the approximate number of times key was
+	// tallied within the sketch's memory.  It never underestimates, except
+	// for the halving done by aging.
+	EstimateHash(key uint64) uint64
+	ShouldReplaceHash(victim, candidate uint64) bool
+	// Hash hashes a string key with the sketch's Hasher.
+	Hash(key string) uint64
+	// Decimations returns the number of times aging has halved every
+	// counter.
+	Decimations() uint64
+}
+
+// Sketch is the interface shared by the TinyLFU sketches: their Counters
+// and the string API that wraps them as a TinyLFU[string].
+type Sketch interface {
+	Counters
+	Tally(key string)
+	TallyN(key string, n uint64)
+	Estimate(key string) uint64
+	ShouldReplace(victim, candidate string) bool
+}
+
+var (
+	_ Sketch = (*TinyLFU32)(nil)
+	_ Sketch = (*TinyLFU64)(nil)
+	_ Sketch = (*TinyLFU4)(nil)
+	_ Sketch = (*TinyLFU8)(nil)
+)
+
+var (
+	BadMemory  = errors.New("tiny_lfu: memory must be positive")
+	BadSpace   = errors.New("tiny_lfu: space too small to hold a counter")
+	BadP       = errors.New("tiny_lfu: false-positive floor must be in (0, 1)")
+	BadHasher  = errors.New("tiny_lfu: hasher must not be nil")
+	BadAging   = errors.New("tiny_lfu: unsupported aging mode")
+	BadStripes = errors.New("tiny_lfu: stripes must not be negative")
 )
+
+// size picks the number of counters and the probes per key for a sketch of
+// width-bit counters that remembers memory tallies within space bytes.  When
+// space allows a false-positive probability below the floor, the sketch is
+// shrunk to just meet the floor rather than wasting the space.
+func size(memory, space, width uint64, o options) (uint64, uint, error) {
+	if memory == 0 {
+		return 0, 0, BadMemory
+	}
+	if o.minP <= 0 || o.minP >= 1 {
+		return 0, 0, BadP
+	}
+	if o.hasher == nil {
+		return 0, 0, BadHasher
+	}
+	if o.aging < AgingReset || o.aging > AgingIncremental {
+		return 0, 0, BadAging
+	}
+	if o.doorP < 0 || o.doorP >= 1 {
+		return 0, 0, BadP
+	}
+	if o.stripes < 0 {
+		return 0, 0, BadStripes
+	}
+	N := float64(memory)
+	M := math.Floor(float64(space) * 8 / float64(width))
+	if M < 1 {
+		return 0, 0, BadSpace
+	}
+	P := bloom.BloomParamsP(N, M)
+	if P < o.minP {
+		P = o.minP
+		M = math.Max(1, math.Floor(bloom.BloomParamsM(N, P)))
+	}
+	K := math.Ceil(bloom.KeysForProbability(P))
+	if K < 1 {
+		K = 1
+	}
+	if K > maxKeys {
+		return 0, 0, BadP
+	}
+	return uint64(M), uint(K), nil
+}
+
+// doorkeeper returns the doorkeeper requested by o, or nil.
+func doorkeeper(memory uint64, o options) *bloom.Concurrent {
+	if o.doorP == 0 {
+		return nil
+	}
+	return bloom.NewConcurrent(memory, o.doorP)
+}
+
+// admit returns how much of a tally of weight n should reach the counters,
+// recording first sightings in the doorkeeper in place of one unit.
+func admit(door *bloom.Concurrent, h, n uint64) uint64 {
+	if door == nil || door.MayContainHash(h) {
+		return n
+	}
+	door.AddHash(h)
+	return n - 1
+}
+
+// seen returns one if the doorkeeper holds h, to credit the tally it kept
+// from the counters.
+func seen(door *bloom.Concurrent, h uint64) uint64 {
+	if door != nil && door.MayContainHash(h) {
+		return 1
+	}
+	return 0
+}
+
+// probe returns the i-th of a key's counters by Kirsch-Mitzenmacher double
+// hashing, so any number of probes may be derived from one 64-bit hash.
+func probe(h1, h2 uint64, i uint, mod uint64) uint64 {
+	return (h1 + uint64(i)*h2) % mod
+}
+
+// crossed reports whether the tally that took a sample counter to sum by
+// adding n is the one that reached memory.
+func crossed(sum, n, memory uint64) bool {
+	return sum >= memory && sum-n < memory
+}
+
+func validKeys(keys uint32) bool {
+	return keys > 0 && keys <= maxKeys
+}
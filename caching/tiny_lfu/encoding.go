@@ -0,0 +1,275 @@
+package tiny_lfu
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+
+	"hack.systems/util/envelope"
+)
+
+func (t *TinyLFU32) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	_, err := t.WriteTo(buf)
+	return buf.Bytes(), err
+}
+
+func (t *TinyLFU32) UnmarshalBinary(data []byte) error {
+	_, err := t.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// WriteTo encodes the sketch.  Decimation is held off for the duration, but
+// tallies that race with the encoding may or may not be reflected in it.
+func (t *TinyLFU32) WriteTo(w io.Writer) (int64, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	e := envelope.NewEncoder(w, envelope.Header{
+		Kind:   envelope.KindTinyLFU32,
+		Hash:   schemeOf(t.hasher),
+		Keys:   uint32(t.keys),
+		Width:  uint64(len(t.counts)),
+		Epoch:  atomic.LoadUint64(&t.epoch),
+		Length: 20 + 4*uint64(len(t.counts)),
+	})
+	e.Uint64(fingerprint(t.hasher))
+	e.Uint32(t.memory)
+	e.Uint32(atomic.LoadUint32(&t.counter))
+	e.Uint32(uint32(t.aging))
+	for i := range t.counts {
+		e.Uint32(atomic.LoadUint32(&t.counts[i]))
+	}
+	return e.Close()
+}
+
+// ReadFrom replaces the sketch with the one encoded in r.  It must not race
+// with any other method on t.  A sketch encoded with a Maphash or HasherFunc
+// can only be read into a sketch already using the same Hasher, as judged by
+// the hash of a fixed key.  The doorkeeper and stripes are not encoded; t
+// keeps its own, cleared.
+func (t *TinyLFU32) ReadFrom(r io.Reader) (int64, error) {
+	d, h, err := envelope.NewDecoder(r)
+	if err != nil {
+		return d.Fail(err)
+	}
+	if h.Kind != envelope.KindTinyLFU32 {
+		return d.Fail(envelope.WrongKind)
+	}
+	hasher, err := hasherFor(h.Hash, t.hasher)
+	if err != nil {
+		return d.Fail(err)
+	}
+	if !validKeys(h.Keys) || h.Width == 0 || h.Length != 20+4*h.Width || h.Epoch&0x1 != 0 {
+		return d.Fail(envelope.BadLength)
+	}
+	if d.Uint64() != fingerprint(hasher) {
+		return d.Fail(envelope.BadHash)
+	}
+	memory := d.Uint32()
+	counter := d.Uint32()
+	aging := Aging(d.Uint32())
+	if memory == 0 || (aging != AgingReset && aging != AgingIncremental) {
+		return d.Fail(envelope.BadLength)
+	}
+	counts := d.Uint32s(h.Width)
+	n, err := d.Close()
+	if err != nil {
+		return n, err
+	}
+	t.memory = memory
+	t.counter = counter
+	t.epoch = h.Epoch
+	t.aging = aging
+	t.keys = uint(h.Keys)
+	t.counts = counts
+	t.blocks = nil
+	if aging == AgingIncremental {
+		t.blocks = make([]uint64, (h.Width+decimationBlock-1)/decimationBlock)
+		for i := range t.blocks {
+			t.blocks[i] = h.Epoch
+		}
+	}
+	t.hasher = hasher
+	t.clearDoorkeeper()
+	t.stripes = t.stripes.reset(uint64(memory))
+	return n, nil
+}
+
+func (t *TinyLFU64) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	_, err := t.WriteTo(buf)
+	return buf.Bytes(), err
+}
+
+func (t *TinyLFU64) UnmarshalBinary(data []byte) error {
+	_, err := t.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// WriteTo encodes the sketch.  Decimation is held off for the duration, but
+// tallies that race with the encoding may or may not be reflected in it.
+func (t *TinyLFU64) WriteTo(w io.Writer) (int64, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	e := envelope.NewEncoder(w, envelope.Header{
+		Kind:   envelope.KindTinyLFU64,
+		Hash:   schemeOf(t.hasher),
+		Keys:   uint32(t.keys),
+		Width:  uint64(len(t.counts)),
+		Epoch:  atomic.LoadUint64(&t.epoch),
+		Length: 32 + 8*uint64(len(t.counts)),
+	})
+	e.Uint64(fingerprint(t.hasher))
+	e.Uint64(t.memory)
+	e.Uint64(atomic.LoadUint64(&t.counter))
+	e.Uint64(uint64(t.aging))
+	for i := range t.counts {
+		e.Uint64(atomic.LoadUint64(&t.counts[i]))
+	}
+	return e.Close()
+}
+
+// ReadFrom replaces the sketch with the one encoded in r.  It must not race
+// with any other method on t.  A sketch encoded with a Maphash or HasherFunc
+// can only be read into a sketch already using the same Hasher, as judged by
+// the hash of a fixed key.  The doorkeeper and stripes are not encoded; t
+// keeps its own, cleared.
+func (t *TinyLFU64) ReadFrom(r io.Reader) (int64, error) {
+	d, h, err := envelope.NewDecoder(r)
+	if err != nil {
+		return d.Fail(err)
+	}
+	if h.Kind != envelope.KindTinyLFU64 {
+		return d.Fail(envelope.WrongKind)
+	}
+	hasher, err := hasherFor(h.Hash, t.hasher)
+	if err != nil {
+		return d.Fail(err)
+	}
+	if !validKeys(h.Keys) || h.Width == 0 || h.Length != 32+8*h.Width || h.Epoch&0x1 != 0 {
+		return d.Fail(envelope.BadLength)
+	}
+	if d.Uint64() != fingerprint(hasher) {
+		return d.Fail(envelope.BadHash)
+	}
+	memory := d.Uint64()
+	counter := d.Uint64()
+	aging := Aging(d.Uint64())
+	if aging < AgingReset || aging > AgingNone || (aging != AgingNone && memory == 0) {
+		return d.Fail(envelope.BadLength)
+	}
+	counts := d.Uint64s(h.Width)
+	n, err := d.Close()
+	if err != nil {
+		return n, err
+	}
+	t.memory = memory
+	t.counter = counter
+	t.epoch = h.Epoch
+	t.aging = aging
+	t.keys = uint(h.Keys)
+	t.counts = counts
+	t.hasher = hasher
+	t.clearDoorkeeper()
+	t.stripes = t.stripes.reset(memory)
+	return n, nil
+}
+
+func (t *packed) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	_, err := t.WriteTo(buf)
+	return buf.Bytes(), err
+}
+
+// WriteTo encodes the sketch.  Decimation is held off for the duration, but
+// tallies that race with the encoding may or may not be reflected in it.
+func (t *packed) WriteTo(w io.Writer) (int64, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	kind := envelope.KindTinyLFU4
+	if t.width == 8 {
+		kind = envelope.KindTinyLFU8
+	}
+	e := envelope.NewEncoder(w, envelope.Header{
+		Kind:   kind,
+		Hash:   schemeOf(t.hasher),
+		Keys:   uint32(t.keys),
+		Width:  t.slots,
+		Epoch:  atomic.LoadUint64(&t.epoch),
+		Length: 24 + 8*uint64(len(t.words)),
+	})
+	e.Uint64(fingerprint(t.hasher))
+	e.Uint64(t.memory)
+	e.Uint64(atomic.LoadUint64(&t.counter))
+	for i := range t.words {
+		e.Uint64(atomic.LoadUint64(&t.words[i]))
+	}
+	return e.Close()
+}
+
+func (t *TinyLFU4) UnmarshalBinary(data []byte) error {
+	_, err := t.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// ReadFrom replaces the sketch with the one encoded in r, under the same
+// conditions as TinyLFU32.ReadFrom.
+func (t *TinyLFU4) ReadFrom(r io.Reader) (int64, error) {
+	return t.readFrom(r, envelope.KindTinyLFU4, 4)
+}
+
+func (t *TinyLFU8) UnmarshalBinary(data []byte) error {
+	_, err := t.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// ReadFrom replaces the sketch with the one encoded in r, under the same
+// conditions as TinyLFU32.ReadFrom.
+func (t *TinyLFU8) ReadFrom(r io.Reader) (int64, error) {
+	return t.readFrom(r, envelope.KindTinyLFU8, 8)
+}
+
+func (t *packed) readFrom(r io.Reader, kind uint8, width uint) (int64, error) {
+	d, h, err := envelope.NewDecoder(r)
+	if err != nil {
+		return d.Fail(err)
+	}
+	if h.Kind != kind {
+		return d.Fail(envelope.WrongKind)
+	}
+	hasher, err := hasherFor(h.Hash, t.hasher)
+	if err != nil {
+		return d.Fail(err)
+	}
+	per := uint64(64 / width)
+	words := (h.Width + per - 1) / per
+	if !validKeys(h.Keys) || h.Width == 0 || h.Length != 24+8*words || h.Epoch&0x1 != 0 {
+		return d.Fail(envelope.BadLength)
+	}
+	if d.Uint64() != fingerprint(hasher) {
+		return d.Fail(envelope.BadHash)
+	}
+	memory := d.Uint64()
+	counter := d.Uint64()
+	if memory == 0 {
+		return d.Fail(envelope.BadLength)
+	}
+	w := d.Uint64s(words)
+	n, err := d.Close()
+	if err != nil {
+		return n, err
+	}
+	t.memory = memory
+	t.counter = counter
+	t.epoch = h.Epoch
+	t.width = width
+	t.keys = uint(h.Keys)
+	t.slots = h.Width
+	t.words = w
+	t.hasher = hasher
+	if t.door != nil {
+		t.door.Clear()
+	}
+	t.stripes = t.stripes.reset(memory)
+	return n, nil
+}
@@ -0,0 +1,268 @@
+package tiny_lfu
+
+import (
+	"hash/maphash"
+	"math/bits"
+
+	"hack.systems/util/bloom"
+	"hack.systems/util/envelope"
+)
+
+// Hasher reduces a key to the single 64-bit hash from which a sketch derives
+// its probes by Kirsch-Mitzenmacher double hashing (see bloom.Derive).  A
+// caller that hashes a key once with the sketch's Hasher may pass the result
+// to the *Hash methods instead of the key.
+type Hasher interface {
+	Hash(key string) uint64
+}
+
+// HasherFunc adapts an ordinary function to a Hasher.  Sketches that use
+// one are encoded with envelope.HashCustom and can only be decoded into a
+// sketch constructed with the same function.
+type HasherFunc func(key string) uint64
+
+func (f HasherFunc) Hash(key string) uint64 {
+	return f(key)
+}
+
+// FNV1a is the default Hasher.  It agrees with bloom.Hash, so a key hashed
+// once may be probed against a TinyLFU and any filter in package bloom.
+type FNV1a struct{}
+
+func (FNV1a) Hash(key string) uint64 {
+	return bloom.Hash(key)
+}
+
+// XXH64 is the xxHash64 algorithm with a zero seed.  It is faster than FNV1a
+// on long keys.
+type XXH64 struct{}
+
+func (XXH64) Hash(key string) uint64 {
+	return xxh64(key)
+}
+
+// Maphash uses the runtime's hash/maphash with a seed chosen at construction.
+// It is fast and resists adversarial keys, but its seed cannot be recorded,
+// so an encoded sketch can only be decoded into a sketch sharing the same
+// *Maphash within the same process.
+type Maphash struct {
+	seed maphash.Seed
+}
+
+func NewMaphash() *Maphash {
+	return &Maphash{
+		seed: maphash.MakeSeed(),
+	}
+}
+
+func (m *Maphash) Hash(key string) uint64 {
+	return maphash.String(m.seed, key)
+}
+
+type Option func(*options)
+
+type options struct {
+	hasher  Hasher
+	minP    float64
+	aging   Aging
+	doorP   float64
+	stripes int
+}
+
+// WithHasher selects how keys are hashed.  The default is FNV1a.
+func WithHasher(h Hasher) Option {
+	return func(o *options) {
+		o.hasher = h
+	}
+}
+
+// WithFalsePositiveFloor sets the lowest false-positive probability the
+// sketch will be sized for, 0.0625 by default.  Space beyond what the floor
+// needs is not allocated.  Lower floors use more counters and more probes
+// per key.
+func WithFalsePositiveFloor(P float64) Option {
+	return func(o *options) {
+		o.minP = P
+	}
+}
+
+// WithDoorkeeper puts a Bloom filter with false-positive probability P in
+// front of the counters.  A key's first tally within a memory window only sets
+// its bits in the doorkeeper; later tallies reach the counters, and estimates
+// add one for keys the doorkeeper holds.  Keys seen once, which dominate most
+// workloads, then cost no counter space, so the sketch can be given less.
+// The doorkeeper is cleared at every decimation, or once per memory tallies
+// with AgingContinuous, and is never cleared with AgingNone.  It occupies
+// about 1.44*log2(1/P) bits per tally of memory on top of space.
+func WithDoorkeeper(P float64) Option {
+	return func(o *options) {
+		o.doorP = P
+	}
+}
+
+// Aging selects how a sketch forgets old tallies so that its estimates
+// track recent popularity.
+type Aging int
+
+const (
+	// AgingReset halves every counter at once after each memory tallies.
+	// This is the default for all but TinyLFU64.  Reads wait for a
+	// decimation in progress.
+	AgingReset Aging = iota
+	// AgingContinuous halves a 1/memory slice of the counters on every
+	// tally, sweeping the whole array once per memory tallies.  Estimates
+	// decay smoothly and no tally pays for a full sweep.
+	AgingContinuous
+	// AgingNone never forgets.
+	AgingNone
+	// AgingIncremental halves the counters after each memory tallies like
+	// AgingReset, but block by block.  Reads that race with the sweep scale
+	// the counters of blocks not yet halved, so ShouldReplace never waits
+	// for a sweep to finish.  A tally that lands in a block not yet halved
+	// is halved with it.  Only TinyLFU32 supports it.
+	AgingIncremental
+)
+
+func WithAging(a Aging) Option {
+	return func(o *options) {
+		o.aging = a
+	}
+}
+
+// WithStripes spreads the sketch's sample counter over n cells, so that
+// goroutines tallying at once on many cores do not contend for one word.
+// The cost is that a decimation may begin up to memory/64 tallies late.  By
+// default the counter is not striped.
+func WithStripes(n int) Option {
+	return func(o *options) {
+		o.stripes = n
+	}
+}
+
+func makeOptions(opts []Option) options {
+	o := options{
+		hasher: FNV1a{},
+		minP:   minP,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func schemeOf(h Hasher) uint8 {
+	switch h.(type) {
+	case FNV1a:
+		return envelope.HashFNV1a64
+	case XXH64:
+		return envelope.HashXXH64
+	case *Maphash:
+		return envelope.HashMaphash
+	default:
+		return envelope.HashCustom
+	}
+}
+
+// hasherFor returns the Hasher that decodes an envelope with the given
+// scheme.  Schemes that cannot be reconstructed are accepted only if the
+// sketch being decoded into already uses a Hasher of that scheme, and the
+// decoder must then check the encoded fingerprint against it.
+func hasherFor(scheme uint8, current Hasher) (Hasher, error) {
+	switch scheme {
+	case envelope.HashFNV1a64:
+		return FNV1a{}, nil
+	case envelope.HashXXH64:
+		return XXH64{}, nil
+	case envelope.HashMaphash, envelope.HashCustom:
+		if current != nil && schemeOf(current) == scheme {
+			return current, nil
+		}
+	}
+	return nil, envelope.BadHash
+}
+
+// fingerprint identifies a Hasher that cannot be reconstructed by its hash
+// of a fixed key, so that a sketch encoded with one Maphash or HasherFunc is
+// not decoded into a sketch using another.  It is zero for other Hashers.
+func fingerprint(h Hasher) uint64 {
+	switch schemeOf(h) {
+	case envelope.HashMaphash, envelope.HashCustom:
+		return h.Hash("hack.systems/util/caching/tiny_lfu")
+	}
+	return 0
+}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+func xxh64(b string) uint64 {
+	n := len(b)
+	var h uint64
+	if n >= 32 {
+		p1, p2 := xxPrime1, xxPrime2
+		v1 := p1 + p2
+		v2 := p2
+		v3 := uint64(0)
+		v4 := -p1
+		for len(b) >= 32 {
+			v1 = xxRound(v1, le64(b[0:8]))
+			v2 = xxRound(v2, le64(b[8:16]))
+			v3 = xxRound(v3, le64(b[16:24]))
+			v4 = xxRound(v4, le64(b[24:32]))
+			b = b[32:]
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) +
+			bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxMerge(h, v1)
+		h = xxMerge(h, v2)
+		h = xxMerge(h, v3)
+		h = xxMerge(h, v4)
+	} else {
+		h = xxPrime5
+	}
+	h += uint64(n)
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxRound(0, le64(b[:8]))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(le32(b[:4])) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for ; len(b) > 0; b = b[1:] {
+		h ^= uint64(b[0]) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMerge(acc, val uint64) uint64 {
+	acc ^= xxRound(0, val)
+	return acc*xxPrime1 + xxPrime4
+}
+
+func le64(b string) uint64 {
+	return uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16 | uint64(b[3])<<24 |
+		uint64(b[4])<<32 | uint64(b[5])<<40 | uint64(b[6])<<48 | uint64(b[7])<<56
+}
+
+func le32(b string) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
@@ -0,0 +1,131 @@
+package main
+
+// ARC is Megiddo and Modha's Adaptive Replacement Cache.  T1 and T2 hold keys
+// seen once and more than once recently, and B1 and B2 remember keys evicted
+// from each.  A miss that hits in a ghost list moves the target size p of T1
+// toward the list that would have kept the key.  Sizes of lists and p are
+// weights, and p moves by the weight of the key.
+type ARC struct {
+	size uint64
+	p    uint64
+	t1   *RecentlyUsedCache
+	t2   *RecentlyUsedCache
+	b1   *RecentlyUsedCache
+	b2   *RecentlyUsedCache
+}
+
+func NewARC(capacity uint64) cache {
+	return &ARC{
+		size: capacity,
+		t1:   NewRUC(),
+		t2:   NewRUC(),
+		b1:   NewRUC(),
+		b2:   NewRUC(),
+	}
+}
+
+func (A *ARC) Warm() bool {
+	return A.t1.Weight+A.t2.Weight >= A.size
+}
+
+func (A *ARC) NextEviction(key string, size uint64) string {
+	if size > A.size {
+		return key
+	}
+	if A.t1.Weight+A.t2.Weight+size <= A.size {
+		return ""
+	}
+	from, _ := A.replace(A.b2.Has(key), A.target(key, size))
+	return from.Back()
+}
+
+func (A *ARC) Insert(key string, size uint64) {
+	if A.Contains(key) {
+		A.Hit(key)
+		return
+	}
+	if size > A.size {
+		return
+	}
+	if A.b1.Has(key) || A.b2.Has(key) {
+		inB2 := A.b2.Has(key)
+		A.p = A.target(key, size)
+		A.b1.Remove(key)
+		A.b2.Remove(key)
+		A.evict(inB2, size)
+		A.t2.InsertFront(key, size)
+		return
+	}
+	for A.t1.Weight+A.b1.Weight+size > A.size && A.b1.List.Len() > 0 {
+		A.b1.Remove(A.b1.Back())
+	}
+	for A.t1.Weight+A.t2.Weight+A.b1.Weight+A.b2.Weight+size > 2*A.size && A.b2.List.Len() > 0 {
+		A.b2.Remove(A.b2.Back())
+	}
+	A.evict(false, size)
+	A.t1.InsertFront(key, size)
+	// T1 and B1 together may hold no more than the cache, so a key pushed
+	// out of a full T1 is not remembered
+	for A.t1.Weight+A.b1.Weight > A.size && A.b1.List.Len() > 0 {
+		A.b1.Remove(A.b1.Back())
+	}
+}
+
+func (A *ARC) Contains(key string) bool {
+	return A.t1.Has(key) || A.t2.Has(key)
+}
+
+func (A *ARC) Len() int {
+	return A.t1.List.Len() + A.t2.List.Len()
+}
+
+func (A *ARC) Hit(key string) {
+	if A.t1.Has(key) {
+		A.t1.MoveTo(key, A.t2)
+	} else {
+		A.t2.MoveToFront(key)
+	}
+}
+
+func (A *ARC) Evict(key string) {
+	A.t1.Remove(key)
+	A.t2.Remove(key)
+	A.b1.Remove(key)
+	A.b2.Remove(key)
+}
+
+// target returns p as adapted by a miss on key.
+func (A *ARC) target(key string, size uint64) uint64 {
+	switch {
+	case A.b1.Has(key):
+		delta := size * max(1, A.b2.Weight/A.b1.Weight)
+		return min(A.size, A.p+delta)
+	case A.b2.Has(key):
+		delta := size * max(1, A.b1.Weight/A.b2.Weight)
+		if delta > A.p {
+			return 0
+		}
+		return A.p - delta
+	}
+	return A.p
+}
+
+// replace returns the list ARC's REPLACE would evict from with target p,
+// and the ghost list the evicted key moves to.  inB2 reports whether the
+// miss is on a key in B2.
+func (A *ARC) replace(inB2 bool, p uint64) (*RecentlyUsedCache, *RecentlyUsedCache) {
+	t1 := A.t1.Weight
+	if t1 > 0 && (t1 > p || (inB2 && t1 == p) || A.t2.List.Len() == 0) {
+		return A.t1, A.b1
+	}
+	return A.t2, A.b2
+}
+
+// evict makes room for size.  Keys removed by Evict leave room that ARC as
+// published would not know to use.
+func (A *ARC) evict(inB2 bool, size uint64) {
+	for A.t1.Weight+A.t2.Weight+size > A.size {
+		from, ghost := A.replace(inB2, A.p)
+		from.MoveTo(from.Back(), ghost)
+	}
+}
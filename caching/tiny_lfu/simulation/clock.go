@@ -0,0 +1,386 @@
+package main
+
+// CLOCK approximates LRU with a reference bit per slot.  The hand sweeps the
+// slots, clearing set bits, and evicts the first key whose bit is clear.
+type CLOCK struct {
+	size  uint64
+	used  uint64
+	keys  []string
+	sizes []uint64
+	ref   []bool
+	slots map[string]int
+	free  []int
+	hand  int
+}
+
+func NewCLOCK(capacity uint64) cache {
+	return &CLOCK{
+		size:  capacity,
+		slots: make(map[string]int),
+	}
+}
+
+func (C *CLOCK) Warm() bool {
+	return C.used >= C.size
+}
+
+func (C *CLOCK) NextEviction(key string, size uint64) string {
+	if size > C.size {
+		return key
+	}
+	if C.used+size <= C.size {
+		return ""
+	}
+	return C.keys[C.victim()]
+}
+
+func (C *CLOCK) Insert(key string, size uint64) {
+	if C.Contains(key) {
+		C.Hit(key)
+		return
+	}
+	if size > C.size {
+		return
+	}
+	for C.used+size > C.size {
+		slot := C.victim()
+		C.Evict(C.keys[slot])
+		C.hand = (slot + 1) % len(C.keys)
+	}
+	var slot int
+	if len(C.free) > 0 {
+		slot = C.free[len(C.free)-1]
+		C.free = C.free[:len(C.free)-1]
+	} else {
+		slot = len(C.keys)
+		C.keys = append(C.keys, "")
+		C.sizes = append(C.sizes, 0)
+		C.ref = append(C.ref, false)
+	}
+	C.keys[slot] = key
+	C.sizes[slot] = size
+	C.ref[slot] = false
+	C.slots[key] = slot
+	C.used += size
+}
+
+func (C *CLOCK) Contains(key string) bool {
+	_, ok := C.slots[key]
+	return ok
+}
+
+func (C *CLOCK) Len() int {
+	return len(C.slots)
+}
+
+func (C *CLOCK) Hit(key string) {
+	C.ref[C.slots[key]] = true
+}
+
+func (C *CLOCK) Evict(key string) {
+	if slot, ok := C.slots[key]; ok {
+		delete(C.slots, key)
+		C.used -= C.sizes[slot]
+		C.keys[slot] = ""
+		C.sizes[slot] = 0
+		C.ref[slot] = false
+		C.free = append(C.free, slot)
+	}
+}
+
+// victim sweeps the hand past free slots to the next slot with a clear bit.
+// The cache must hold at least one key.
+func (C *CLOCK) victim() int {
+	for {
+		if _, ok := C.slots[C.keys[C.hand]]; ok && !C.ref[C.hand] {
+			return C.hand
+		}
+		C.ref[C.hand] = false
+		C.hand = (C.hand + 1) % len(C.keys)
+	}
+}
+
+// CLOCKPro is Jiang, Chen and Zhang's CLOCK-Pro.  Resident keys are hot or
+// cold, and every key that enters the cache, or is read while cold, starts a
+// test period at the head of the ring.  A cold key evicted during its test
+// period stays in the ring as a non-resident key, and a key read again during
+// its test period turns hot and grows the target for cold keys.  Test periods
+// that end without a read shrink the target, which starts at 1% of the cache,
+// as in LIRS.  Three hands sweep the ring from its tail: the cold hand evicts
+// cold keys, the hot hand demotes hot keys when they exceed their share, and
+// the test hand ends test periods when non-resident keys outnumber the cache.
+// Counts of keys and the cold target are weights.
+type CLOCKPro struct {
+	size        uint64
+	coldTarget  uint64
+	hot         uint64
+	cold        uint64
+	nonresident uint64
+	resident    int
+	entries     map[string]*clockProEntry
+	handHot     *clockProEntry
+	handCold    *clockProEntry
+	handTest    *clockProEntry
+}
+
+type clockProKind uint8
+
+const (
+	clockProHot clockProKind = iota
+	clockProCold
+	clockProNonresident
+)
+
+type clockProEntry struct {
+	key  string
+	size uint64
+	kind clockProKind
+	ref  bool
+	// test is true for cold keys in their test period; non-resident keys
+	// are always in theirs
+	test bool
+	prev *clockProEntry
+	next *clockProEntry
+}
+
+func NewCLOCKPro(capacity uint64) cache {
+	return &CLOCKPro{
+		size:       capacity,
+		coldTarget: min(capacity, max(1, capacity/100)),
+		entries:    make(map[string]*clockProEntry),
+	}
+}
+
+func (C *CLOCKPro) Warm() bool {
+	return C.hot+C.cold >= C.size
+}
+
+// NextEviction runs the cold hand until it rests on the cold, unreferenced
+// key that the next Insert will evict.
+func (C *CLOCKPro) NextEviction(key string, size uint64) string {
+	if size > C.size {
+		return key
+	}
+	if C.hot+C.cold+size <= C.size {
+		return ""
+	}
+	return C.coldVictim().key
+}
+
+func (C *CLOCKPro) Insert(key string, size uint64) {
+	e, ok := C.entries[key]
+	if ok && e.kind != clockProNonresident {
+		e.ref = true
+		return
+	}
+	if size > C.size {
+		return
+	}
+	if ok {
+		C.coldTarget = min(C.size, C.coldTarget+e.size)
+		C.nonresident -= e.size
+		C.remove(e)
+	}
+	for C.hot+C.cold+size > C.size {
+		C.reclaim(C.coldVictim())
+	}
+	e = &clockProEntry{key: key, size: size, kind: clockProCold, test: true}
+	C.entries[key] = e
+	C.link(e)
+	C.resident++
+	if !ok {
+		C.cold += size
+		return
+	}
+	e.kind, e.test = clockProHot, false
+	C.hot += size
+	C.balance()
+}
+
+func (C *CLOCKPro) Contains(key string) bool {
+	e, ok := C.entries[key]
+	return ok && e.kind != clockProNonresident
+}
+
+func (C *CLOCKPro) Len() int {
+	return C.resident
+}
+
+func (C *CLOCKPro) Hit(key string) {
+	C.entries[key].ref = true
+}
+
+func (C *CLOCKPro) Evict(key string) {
+	e, ok := C.entries[key]
+	if !ok {
+		return
+	}
+	switch e.kind {
+	case clockProHot:
+		C.hot -= e.size
+		C.resident--
+	case clockProCold:
+		C.cold -= e.size
+		C.resident--
+	case clockProNonresident:
+		C.nonresident -= e.size
+	}
+	C.remove(e)
+}
+
+// coldVictim runs the cold hand until it rests on a cold key with a clear
+// reference bit, and returns that key.  Cold keys read during their test
+// period turn hot on the way, and other cold keys read start a new test
+// period.  Both move to the head.  If no key is cold, the hot hand demotes
+// one.  There must be a resident key.
+func (C *CLOCKPro) coldVictim() *clockProEntry {
+	for {
+		if C.cold == 0 {
+			C.runHandHot()
+			continue
+		}
+		e := C.handCold
+		if e.kind != clockProCold {
+			C.handCold = e.next
+			continue
+		}
+		if !e.ref {
+			return e
+		}
+		C.handCold = e.next
+		e.ref = false
+		if !e.test {
+			e.test = true
+			C.toHead(e)
+			continue
+		}
+		e.kind, e.test = clockProHot, false
+		C.cold -= e.size
+		C.hot += e.size
+		C.coldTarget = min(C.size, C.coldTarget+e.size)
+		C.toHead(e)
+		C.balance()
+	}
+}
+
+// reclaim evicts e, the key under the cold hand.  A key in its test period
+// stays in the ring as a non-resident key until the period ends.
+func (C *CLOCKPro) reclaim(e *clockProEntry) {
+	C.handCold = e.next
+	C.cold -= e.size
+	C.resident--
+	if !e.test {
+		C.remove(e)
+		return
+	}
+	e.kind = clockProNonresident
+	C.nonresident += e.size
+	for C.nonresident > C.size {
+		C.runHandTest()
+	}
+}
+
+// balance runs the hot hand until hot keys are within their share.
+func (C *CLOCKPro) balance() {
+	for C.hot > C.size-C.coldTarget {
+		C.runHandHot()
+	}
+}
+
+// runHandHot runs the hot hand until it demotes a hot key with a clear
+// reference bit, clearing the bits of the hot keys it passes.  Like the
+// test hand, it ends the test period of each key it passes, and it pushes
+// the test hand along when it catches up.  There must be a hot key.
+func (C *CLOCKPro) runHandHot() {
+	for {
+		e := C.handHot
+		C.handHot = e.next
+		if C.handTest == e {
+			C.handTest = e.next
+		}
+		switch {
+		case e.kind != clockProHot:
+			C.endTest(e)
+		case e.ref:
+			e.ref = false
+		default:
+			e.kind = clockProCold
+			C.hot -= e.size
+			C.cold += e.size
+			return
+		}
+	}
+}
+
+// runHandTest runs the test hand until it drops a non-resident key, ending
+// the test period of each key it passes.  There must be a non-resident key.
+func (C *CLOCKPro) runHandTest() {
+	for {
+		e := C.handTest
+		C.handTest = e.next
+		C.endTest(e)
+		if e.kind == clockProNonresident {
+			return
+		}
+	}
+}
+
+// endTest ends the test period of e, if it is in one, dropping e if it is
+// non-resident.  A test period that ends without a read shrinks the cold
+// target.
+func (C *CLOCKPro) endTest(e *clockProEntry) {
+	if !e.test {
+		return
+	}
+	e.test = false
+	C.coldTarget = max(C.coldTarget, e.size+1) - e.size
+	if e.kind == clockProNonresident {
+		C.nonresident -= e.size
+		C.remove(e)
+	}
+}
+
+// remove drops e from the ring and the cache's entries.
+func (C *CLOCKPro) remove(e *clockProEntry) {
+	delete(C.entries, e.key)
+	C.unlink(e)
+}
+
+// toHead moves e to the head of the ring, where the hands reach it last.
+func (C *CLOCKPro) toHead(e *clockProEntry) {
+	C.unlink(e)
+	C.link(e)
+}
+
+// link places e at the head of the ring, just behind the hot hand, which
+// rests on the tail.
+func (C *CLOCKPro) link(e *clockProEntry) {
+	if C.handHot == nil {
+		e.prev, e.next = e, e
+		C.handHot, C.handCold, C.handTest = e, e, e
+		return
+	}
+	e.prev, e.next = C.handHot.prev, C.handHot
+	e.prev.next = e
+	e.next.prev = e
+}
+
+// unlink removes e from the ring.  Hands resting on e move on to the next
+// entry.
+func (C *CLOCKPro) unlink(e *clockProEntry) {
+	if e.next == e {
+		C.handHot, C.handCold, C.handTest = nil, nil, nil
+		return
+	}
+	if C.handHot == e {
+		C.handHot = e.next
+	}
+	if C.handCold == e {
+		C.handCold = e.next
+	}
+	if C.handTest == e {
+		C.handTest = e.next
+	}
+	e.prev.next = e.next
+	e.next.prev = e.prev
+}
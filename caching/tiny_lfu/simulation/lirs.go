@@ -0,0 +1,240 @@
+package main
+
+import (
+	"container/list"
+)
+
+// LIRS is Jiang and Zhang's Low Inter-reference Recency Set.  Keys with a
+// short reuse distance are LIR and hold 99% of the cache; the rest are HIR,
+// and only HIR keys are evicted.  The stack orders keys by recency and
+// decides when an HIR key's reuse distance beats the oldest LIR key's, and
+// the queue orders resident HIR keys for eviction.  HIR keys evicted while
+// still in the stack stay there as non-resident ghosts, weighing at most
+// the cache in all.  Counts of keys are weights.
+type LIRS struct {
+	size     uint64
+	lirSize  uint64
+	lir      uint64
+	resident uint64
+	ghost    uint64
+	stack    *list.List
+	queue    *list.List
+	ghosts   *list.List
+	entries  map[string]*lirsEntry
+}
+
+type lirsState uint8
+
+const (
+	lirsLIR lirsState = iota
+	lirsHIR
+	lirsGhost
+)
+
+// lirsEntry is a key and its place in each list it belongs to.
+type lirsEntry struct {
+	key   string
+	size  uint64
+	state lirsState
+	s     *list.Element
+	q     *list.Element
+	g     *list.Element
+}
+
+func NewLIRS(capacity uint64) cache {
+	return &LIRS{
+		size:    capacity,
+		lirSize: capacity - min(capacity, max(1, capacity/100)),
+		stack:   list.New(),
+		queue:   list.New(),
+		ghosts:  list.New(),
+		entries: make(map[string]*lirsEntry),
+	}
+}
+
+func (L *LIRS) Warm() bool {
+	return L.resident >= L.size
+}
+
+func (L *LIRS) NextEviction(key string, size uint64) string {
+	if size > L.size {
+		return key
+	}
+	if L.resident+size <= L.size {
+		return ""
+	}
+	if elem := L.queue.Back(); elem != nil {
+		return elem.Value.(*lirsEntry).key
+	}
+	L.prune()
+	return L.stack.Back().Value.(*lirsEntry).key
+}
+
+func (L *LIRS) Insert(key string, size uint64) {
+	if L.Contains(key) {
+		L.Hit(key)
+		return
+	}
+	if size > L.size {
+		return
+	}
+	for L.resident+size > L.size {
+		L.evict()
+	}
+	L.resident += size
+	e, ok := L.entries[key]
+	if ok {
+		// a ghost is in the stack, so its reuse distance beats the
+		// oldest LIR key's
+		L.ghosts.Remove(e.g)
+		L.ghost -= e.size
+		e.g = nil
+		e.size = size
+		L.top(e)
+		L.promote(e)
+		return
+	}
+	e = &lirsEntry{key: key, size: size}
+	L.entries[key] = e
+	L.top(e)
+	if L.lir+size <= L.lirSize {
+		e.state = lirsLIR
+		L.lir += size
+		return
+	}
+	e.state = lirsHIR
+	e.q = L.queue.PushFront(e)
+}
+
+func (L *LIRS) Contains(key string) bool {
+	e, ok := L.entries[key]
+	return ok && e.state != lirsGhost
+}
+
+func (L *LIRS) Len() int {
+	return len(L.entries) - L.ghosts.Len()
+}
+
+func (L *LIRS) Hit(key string) {
+	e := L.entries[key]
+	switch {
+	case e.state == lirsLIR:
+		bottom := L.stack.Back() == e.s
+		L.top(e)
+		if bottom {
+			L.prune()
+		}
+	case e.s != nil:
+		L.top(e)
+		L.queue.Remove(e.q)
+		e.q = nil
+		L.promote(e)
+	default:
+		L.top(e)
+		L.queue.MoveToFront(e.q)
+	}
+}
+
+func (L *LIRS) Evict(key string) {
+	e, ok := L.entries[key]
+	if !ok {
+		return
+	}
+	if e.state == lirsLIR {
+		L.lir -= e.size
+	}
+	if e.state != lirsGhost {
+		L.resident -= e.size
+	}
+	L.forget(e)
+	L.prune()
+}
+
+// evict removes the oldest resident HIR key, or the oldest LIR key if there
+// are none.
+func (L *LIRS) evict() {
+	elem := L.queue.Back()
+	if elem == nil {
+		L.prune()
+		e := L.stack.Back().Value.(*lirsEntry)
+		L.forget(e)
+		L.lir -= e.size
+		L.resident -= e.size
+		L.prune()
+		return
+	}
+	e := elem.Value.(*lirsEntry)
+	L.queue.Remove(elem)
+	e.q = nil
+	L.resident -= e.size
+	if e.s == nil {
+		delete(L.entries, e.key)
+		return
+	}
+	e.state = lirsGhost
+	e.g = L.ghosts.PushFront(e)
+	L.ghost += e.size
+	for L.ghost > L.size {
+		L.forget(L.ghosts.Back().Value.(*lirsEntry))
+	}
+}
+
+// promote makes e, at the top of the stack, LIR, and demotes the oldest LIR
+// keys to HIR while there are too many.
+func (L *LIRS) promote(e *lirsEntry) {
+	e.state = lirsLIR
+	L.lir += e.size
+	for L.lir > L.lirSize {
+		// with no LIR keys before e, HIR keys may lie beneath it
+		L.prune()
+		elem := L.stack.Back()
+		bottom := elem.Value.(*lirsEntry)
+		L.stack.Remove(elem)
+		bottom.s = nil
+		bottom.state = lirsHIR
+		bottom.q = L.queue.PushFront(bottom)
+		L.lir -= bottom.size
+	}
+	L.prune()
+}
+
+// top moves e to the top of the stack.
+func (L *LIRS) top(e *lirsEntry) {
+	if e.s != nil {
+		L.stack.MoveToFront(e.s)
+	} else {
+		e.s = L.stack.PushFront(e)
+	}
+}
+
+// prune removes HIR keys from the bottom of the stack, forgetting ghosts,
+// so that the bottom is the oldest LIR key.
+func (L *LIRS) prune() {
+	for elem := L.stack.Back(); elem != nil; elem = L.stack.Back() {
+		e := elem.Value.(*lirsEntry)
+		if e.state == lirsLIR {
+			break
+		}
+		if e.state == lirsGhost {
+			L.forget(e)
+		} else {
+			L.stack.Remove(elem)
+			e.s = nil
+		}
+	}
+}
+
+// forget removes e from every list and the cache.
+func (L *LIRS) forget(e *lirsEntry) {
+	if e.s != nil {
+		L.stack.Remove(e.s)
+	}
+	if e.q != nil {
+		L.queue.Remove(e.q)
+	}
+	if e.g != nil {
+		L.ghosts.Remove(e.g)
+		L.ghost -= e.size
+	}
+	delete(L.entries, e.key)
+}
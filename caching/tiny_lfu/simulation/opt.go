@@ -0,0 +1,143 @@
+package main
+
+import (
+	"container/heap"
+	"math"
+)
+
+// OPT is Belady's optimal policy.  It reads the whole trace in advance, and
+// evicts the key whose next read is furthest in the future, declining keys
+// that will be read later than every key it holds.  A write invalidates the
+// cached copy, so a read is only a use of the copy if no write intervenes.
+// OPT ignores sizes in choosing victims, so with objects of varied sizes it
+// is a strong policy rather than an optimal one.
+type OPT struct {
+	size   uint64
+	weight uint64
+	// next[i] is the position of the next use of the key read at i
+	next []int
+	pos  int
+	heap optHeap
+}
+
+// never is the next use of a key that will not be read again.
+const never = math.MaxInt
+
+func NewOPT(capacity uint64, ops []op) cache {
+	next := make([]int, len(ops))
+	uses := make(map[string]int)
+	for i := len(ops) - 1; i >= 0; i-- {
+		if !ops[i].read {
+			uses[ops[i].key] = never
+			continue
+		}
+		if n, ok := uses[ops[i].key]; ok {
+			next[i] = n
+		} else {
+			next[i] = never
+		}
+		uses[ops[i].key] = i
+	}
+	return &OPT{
+		size: capacity,
+		next: next,
+		heap: optHeap{index: make(map[string]int)},
+	}
+}
+
+func (O *OPT) Seek(i int) {
+	O.pos = i
+}
+
+func (O *OPT) Warm() bool {
+	return O.weight >= O.size
+}
+
+func (O *OPT) NextEviction(key string, size uint64) string {
+	if size > O.size {
+		return key
+	}
+	if O.weight+size <= O.size {
+		return ""
+	}
+	if O.next[O.pos] >= O.heap.keys[0].next {
+		return key
+	}
+	return O.heap.keys[0].key
+}
+
+func (O *OPT) Insert(key string, size uint64) {
+	if O.Contains(key) {
+		O.Hit(key)
+		return
+	}
+	for O.weight+size > O.size {
+		if O.NextEviction(key, size) == key {
+			return
+		}
+		O.weight -= heap.Pop(&O.heap).(optKey).size
+	}
+	heap.Push(&O.heap, optKey{key: key, next: O.next[O.pos], size: size})
+	O.weight += size
+}
+
+func (O *OPT) Contains(key string) bool {
+	_, ok := O.heap.index[key]
+	return ok
+}
+
+func (O *OPT) Len() int {
+	return O.heap.Len()
+}
+
+func (O *OPT) Hit(key string) {
+	i := O.heap.index[key]
+	O.heap.keys[i].next = O.next[O.pos]
+	heap.Fix(&O.heap, i)
+}
+
+func (O *OPT) Evict(key string) {
+	if i, ok := O.heap.index[key]; ok {
+		O.weight -= heap.Remove(&O.heap, i).(optKey).size
+	}
+}
+
+type optKey struct {
+	key  string
+	next int
+	size uint64
+}
+
+// optHeap is a max-heap of keys by next use that keeps index current.
+type optHeap struct {
+	keys  []optKey
+	index map[string]int
+}
+
+func (h *optHeap) Len() int {
+	return len(h.keys)
+}
+
+func (h *optHeap) Less(i, j int) bool {
+	return h.keys[i].next > h.keys[j].next
+}
+
+func (h *optHeap) Swap(i, j int) {
+	h.keys[i], h.keys[j] = h.keys[j], h.keys[i]
+	h.index[h.keys[i].key] = i
+	h.index[h.keys[j].key] = j
+}
+
+func (h *optHeap) Push(x interface{}) {
+	k := x.(optKey)
+	h.index[k.key] = len(h.keys)
+	h.keys = append(h.keys, k)
+}
+
+func (h *optHeap) Pop() interface{} {
+	n := len(h.keys) - 1
+	k := h.keys[n]
+	h.keys = h.keys[:n]
+	delete(h.index, k.key)
+	return k
+}
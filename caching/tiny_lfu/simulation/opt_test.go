@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// reads returns a trace that reads each byte of keys as a key.
+func reads(keys string) []op {
+	ops := make([]op, len(keys))
+	for i := range keys {
+		ops[i] = op{key: keys[i : i+1], read: true}
+	}
+	return ops
+}
+
+func TestOPTNextUse(t *testing.T) {
+	require := require.New(t)
+
+	ops := reads("abcaaba")
+	ops[3].read = false
+	O := NewOPT(2, ops).(*OPT)
+	// the write at 3 means a's read at 0 has no next use
+	require.Equal([]int{never, 5, never, 0, 6, never, never}, O.next)
+}
+
+func TestOPT(t *testing.T) {
+	require := require.New(t)
+
+	// c is read again before b, so it takes b's place
+	keys := "abcacb"
+	require.Equal("...hh.", replay(NewOPT(2, reads(keys)), keys))
+	// c is never read again, so OPT declines it
+	keys = "abcab"
+	require.Equal("...hh", replay(NewOPT(2, reads(keys)), keys))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// replay reads each byte of keys as a key of size one through C, as simulate
+// does without TinyLFU, and returns h for each hit and . for each miss.
+func replay(C cache, keys string) string {
+	cv, _ := C.(clairvoyant)
+	out := make([]byte, len(keys))
+	for i := range keys {
+		if cv != nil {
+			cv.Seek(i)
+		}
+		key := keys[i : i+1]
+		out[i] = '.'
+		if C.Contains(key) {
+			C.Hit(key)
+			out[i] = 'h'
+		} else if C.NextEviction(key, 1) != key {
+			C.Insert(key, 1)
+		}
+	}
+	return string(out)
+}
+
+func TestPolicies(t *testing.T) {
+	require := require.New(t)
+
+	for _, p := range []struct {
+		name string
+		C    cache
+		keys string
+		want string
+	}{
+		// the hit refreshes a, so c evicts b
+		{"LRU", NewLRU(2), "abacab", "..h.h."},
+		// c evicts a, the first in, despite its hit
+		{"FIFO", NewFIFO(2), "abacab", "..h..."},
+		// the hand clears both bits and evicts a, the more recent
+		{"CLOCK", NewCLOCK(2), "abbaca", "..hh.."},
+		// b, read while cold, turns hot and outlives e, f and g
+		{"CLOCK-Pro", NewCLOCKPro(3), "abcdbefgb", "....h...h"},
+		// a, read twice, waits in T2 while T1 turns over
+		{"ARC", NewARC(2), "aabcda", ".h...h"},
+		// c returns while a ghost and becomes LIR, demoting a, and e
+		// evicts a rather than LIR b
+		{"LIRS", NewLIRS(3), "abcdceba", "......h."},
+		// a and b return from A1out to Am, where the scan fgh leaves them
+		{"2Q", NewTwoQ(4), "abcdeababfghab", ".......hh...hh"},
+		// a and b are protected from the scan cdefg
+		{"SLRU", NewSLRU(5), "ababcdefgab", "..hh.....hh"},
+		// a, read while in the small FIFO, moves to main and outlives
+		// the ten keys after it
+		{"S3-FIFO", NewS3FIFO(10), "abcdefghijaklmnopqrsta", "..........h..........h"},
+	} {
+		require.Equal(p.want, replay(p.C, p.keys), p.name)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"container/list"
+)
+
+// S3FIFO is Yang et al.'s S3-FIFO.  New keys enter a small FIFO holding 10%
+// of the cache; those read again before reaching its tail move to the main
+// FIFO, and the rest are remembered in a ghost FIFO so that a quick return
+// goes straight to main.  Main reinserts keys read since they last reached
+// its tail, spending one of at most three reads each time.
+type S3FIFO struct {
+	size      uint64
+	smallSize uint64
+	used      uint64
+	smallUsed uint64
+	small     *list.List
+	main      *list.List
+	entries   map[string]*list.Element
+	ghost     *RecentlyUsedCache
+}
+
+type s3Entry struct {
+	key   string
+	size  uint64
+	freq  uint8
+	small bool
+}
+
+func NewS3FIFO(capacity uint64) cache {
+	return &S3FIFO{
+		size:      capacity,
+		smallSize: max(1, capacity/10),
+		small:     list.New(),
+		main:      list.New(),
+		entries:   make(map[string]*list.Element),
+		ghost:     NewRUC(),
+	}
+}
+
+func (S *S3FIFO) Warm() bool {
+	return S.used >= S.size
+}
+
+func (S *S3FIFO) NextEviction(key string, size uint64) string {
+	if size > S.size {
+		return key
+	}
+	if elem := S.victim(size); elem != nil {
+		return elem.Value.(*s3Entry).key
+	}
+	return ""
+}
+
+func (S *S3FIFO) Insert(key string, size uint64) {
+	if S.Contains(key) {
+		S.Hit(key)
+		return
+	}
+	if size > S.size {
+		return
+	}
+	for elem := S.victim(size); elem != nil; elem = S.victim(size) {
+		e := elem.Value.(*s3Entry)
+		S.remove(elem)
+		if e.small {
+			S.ghost.InsertFront(e.key, e.size)
+			for S.ghost.Weight > S.size-S.smallSize {
+				S.ghost.Remove(S.ghost.Back())
+			}
+		}
+	}
+	e := &s3Entry{key: key, size: size}
+	S.used += size
+	if S.ghost.Has(key) {
+		S.ghost.Remove(key)
+		S.entries[key] = S.main.PushFront(e)
+	} else {
+		e.small = true
+		S.smallUsed += size
+		S.entries[key] = S.small.PushFront(e)
+	}
+}
+
+func (S *S3FIFO) Contains(key string) bool {
+	_, ok := S.entries[key]
+	return ok
+}
+
+func (S *S3FIFO) Len() int {
+	return len(S.entries)
+}
+
+func (S *S3FIFO) Hit(key string) {
+	e := S.entries[key].Value.(*s3Entry)
+	if e.freq < 3 {
+		e.freq++
+	}
+}
+
+func (S *S3FIFO) Evict(key string) {
+	if elem, ok := S.entries[key]; ok {
+		S.remove(elem)
+	}
+	S.ghost.Remove(key)
+}
+
+// victim moves keys between and within the FIFOs until the tail of the FIFO
+// being evicted from holds a key that has not been read, and returns it.
+// It returns nil if the cache has room for size.
+func (S *S3FIFO) victim(size uint64) *list.Element {
+	for S.used+size > S.size {
+		if S.smallUsed >= S.smallSize || S.main.Len() == 0 {
+			elem := S.small.Back()
+			e := elem.Value.(*s3Entry)
+			if e.freq == 0 {
+				return elem
+			}
+			S.small.Remove(elem)
+			S.smallUsed -= e.size
+			e.freq = 0
+			e.small = false
+			S.entries[e.key] = S.main.PushFront(e)
+			continue
+		}
+		elem := S.main.Back()
+		e := elem.Value.(*s3Entry)
+		if e.freq == 0 {
+			return elem
+		}
+		e.freq--
+		S.main.MoveToFront(elem)
+	}
+	return nil
+}
+
+func (S *S3FIFO) remove(elem *list.Element) {
+	e := elem.Value.(*s3Entry)
+	S.used -= e.size
+	if e.small {
+		S.small.Remove(elem)
+		S.smallUsed -= e.size
+	} else {
+		S.main.Remove(elem)
+	}
+	delete(S.entries, e.key)
+}
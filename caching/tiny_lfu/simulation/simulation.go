@@ -3,54 +3,125 @@ package main
 import (
 	"container/list"
 	"flag"
-
-	"hack.systems/random/armnod"
-	"hack.systems/random/guacamole"
+	"math"
+	"runtime"
+	"sync"
 
 	"hack.systems/util/caching/tiny_lfu"
 	"hack.systems/util/ubench"
 )
 
+// cache is an eviction policy.  Capacity and sizes are in the same units,
+// which are objects, each of size one, unless the cache holds bytes.
 type cache interface {
 	Warm() bool
-	NextEviction(key string) string
-	Insert(key string)
+	// NextEviction returns the first key that inserting key would evict,
+	// "" if there is room, or key itself if the cache would not keep key.
+	// Policies that sweep to find a victim may do so here; the following
+	// Insert evicts the key returned, and as many more as it needs.
+	NextEviction(key string, size uint64) string
+	Insert(key string, size uint64)
 	Contains(key string) bool
+	// Len returns the number of keys the cache holds.
+	Len() int
+	// Hit records a read of a key the cache contains.
+	Hit(key string)
 	Evict(key string)
 }
 
 type parameters struct {
 	// Workload generation
-	Operations uint64  `number of cache operations to perform`
-	ReadRatio  float64 `probability of an operation being a read`
-	Objects    uint64  `number of cacheable objects`
-	ZipfTheta  float64 `theta parameter to zipf distribution`
-	Seed       uint64  `guacamole seed`
+	Trace       string  `path of a trace to replay, or none to generate a workload`
+	TraceFormat string  `format of the trace: keys, lirs, arc, csv, or binary`
+	SaveTrace   string  `path to save the workload to in the binary trace format, or none`
+	Operations  uint64  `number of cache operations to perform`
+	ReadRatio   float64 `probability of an operation being a read`
+	Objects     uint64  `number of cacheable objects`
+	ZipfTheta   float64 `theta parameter to zipf distribution`
+	Seed        uint64  `guacamole seed`
+	Sizes       string  `distribution of object sizes: constant, uniform, exponential, pareto, or lognormal`
+	MeanSize    uint64  `mean object size in bytes, for objects without a size in the trace`
+	// Workload phases
+	ShiftEvery    uint64  `operations between rotations of the popular keys; 0 never rotates`
+	ShiftBy       uint64  `ranks by which each rotation moves the popular keys`
+	ScanEvery     uint64  `operations between scans of keys read once; 0 never scans`
+	ScanLength    uint64  `keys read by each scan`
+	LoopRatio     float64 `probability of an operation coming from a loop over LoopLength keys`
+	LoopLength    uint64  `keys in the loop, read in order`
+	DiurnalPeriod uint64  `operations per cycle through a second set of popular keys; 0 never cycles`
+	LocalityRatio float64 `probability of an operation reusing a recent key`
+	StackDistance uint64  `mean stack distance of the recent keys reused`
 	// TinyLFU configuration
-	UseTLFU bool
-	Memory  uint64 `memory parameter to TinyLFU`
-	Space   uint64 `space parameter to TinyLFU`
+	UseTLFU    bool    `admit misses only if TinyLFU prefers them to the victim; the default, false,true, runs both`
+	Sketch     string  `TinyLFU sketch: TinyLFU32, TinyLFU64, TinyLFU4, or TinyLFU8`
+	Aging      string  `aging of the sketch: default, reset, incremental, continuous, or none, as the sketch supports`
+	Memory     uint64  `memory parameter to TinyLFU`
+	Space      uint64  `space parameter to TinyLFU`
+	Doorkeeper float64 `false-positive probability of the TinyLFU doorkeeper; 0 disables it`
 	// Cache configuration
-	Algorithm string `cache eviction algorithm to simulate`
-	CacheSize uint64 `objects that can fit in cache`
+	Algorithm  string `cache eviction algorithm to simulate: FIFO, LRU, OPT, ARC, LIRS, CLOCK, CLOCK-Pro, 2Q, SLRU, or S3-FIFO; LRU promotes on hit, unlike earlier versions`
+	CacheSize  uint64 `objects that can fit in cache`
+	CacheBytes uint64 `bytes that can fit in cache; 0 to count objects with CacheSize instead`
+	// Output
+	Window uint64 `operations per row of windowed metrics; 0 for one row of totals per run`
 }
 
-type result struct {
-	Reads   uint64 `number of read operations performed`
-	Hits    uint64 `number of cache hits`
-	Inserts uint64 `number of cache misses that populated the entry`
-	Writes  uint64 `number of writes/invalidations`
+// capacity returns the capacity of the cache in its units.
+func (p parameters) capacity() uint64 {
+	if p.CacheBytes > 0 {
+		return p.CacheBytes
+	}
+	return p.CacheSize
+}
+
+// cost returns the size of o in the cache's units.
+func (p parameters) cost(o op) uint64 {
+	if p.CacheBytes > 0 {
+		return o.size
+	}
+	return 1
 }
 
+type result struct {
+	Reads        uint64  `number of read operations performed`
+	Hits         uint64  `number of cache hits`
+	Inserts      uint64  `number of cache misses that populated the entry`
+	Writes       uint64  `number of writes/invalidations`
+	ReadBytes    uint64  `bytes read`
+	HitBytes     uint64  `bytes read from cache`
+	ByteHitRatio float64 `fraction of bytes read from cache`
+	Rejections   uint64  `number of cache misses TinyLFU declined to admit`
+	Evictions    uint64  `number of keys evicted to make room`
+	Unweighed    uint64  `number of keys evicted by an admitted miss without TinyLFU weighing them against it`
+	Decimations  uint64  `number of times TinyLFU aged its counters`
+}
+
+// sample is the metrics of one window of operations.
+type sample struct {
+	Operations  uint64  `operations performed by the end of the window`
+	Reads       uint64  `number of read operations performed in the window`
+	Hits        uint64  `number of cache hits in the window`
+	HitRatio    float64 `fraction of reads that hit in the window`
+	Rejections  uint64  `number of cache misses TinyLFU declined to admit in the window`
+	Evictions   uint64  `number of keys evicted in the window`
+	Unweighed   uint64  `number of keys evicted by an admitted miss without TinyLFU weighing them against it in the window`
+	Decimations uint64  `number of times TinyLFU aged its counters in the window`
+}
+
+// RecentlyUsedCache is a list of keys, most recent first, that tracks the
+// total size of its keys.
 type RecentlyUsedCache struct {
-	List  *list.List
-	Items map[string]*list.Element
+	List   *list.List
+	Items  map[string]*list.Element
+	Sizes  map[string]uint64
+	Weight uint64
 }
 
 func NewRUC() *RecentlyUsedCache {
 	c := &RecentlyUsedCache{
 		List:  list.New(),
 		Items: make(map[string]*list.Element),
+		Sizes: make(map[string]uint64),
 	}
 	return c
 }
@@ -63,21 +134,39 @@ func (C *RecentlyUsedCache) MoveToFront(key string) {
 	}
 }
 
-func (C *RecentlyUsedCache) InsertFront(key string) {
+func (C *RecentlyUsedCache) InsertFront(key string, size uint64) {
 	if _, ok := C.Items[key]; ok {
 		panic("invariants broken")
 	}
 	elem := C.List.PushFront(key)
 	C.Items[key] = elem
+	C.Sizes[key] = size
+	C.Weight += size
 }
 
 func (C *RecentlyUsedCache) Remove(key string) {
 	if elem, ok := C.Items[key]; ok {
 		C.List.Remove(elem)
-		delete(C.Items, elem.Value.(string))
+		delete(C.Items, key)
+		C.Weight -= C.Sizes[key]
+		delete(C.Sizes, key)
 	}
 }
 
+// MoveTo moves key from C to the front of D.
+func (C *RecentlyUsedCache) MoveTo(key string, D *RecentlyUsedCache) {
+	size := C.Sizes[key]
+	C.Remove(key)
+	D.InsertFront(key, size)
+}
+
+func (C *RecentlyUsedCache) Back() string {
+	if C.List.Len() > 0 {
+		return C.List.Back().Value.(string)
+	}
+	return ""
+}
+
 func (C *RecentlyUsedCache) Has(key string) bool {
 	_, ok := C.Items[key]
 	return ok
@@ -100,22 +189,24 @@ func NewFIFO(capacity uint64) cache {
 }
 
 func (F *FIFO) Warm() bool {
-	return F.ruc.Size() >= F.size
+	return F.ruc.Weight >= F.size
 }
 
-func (F *FIFO) NextEviction(key string) string {
-	if F.ruc.List.Len() > 0 {
-		return F.ruc.List.Back().Value.(string)
+// NextEviction returns the oldest key even if there is room, as it always
+// has, so TinyLFU may turn away a key that would evict nothing.
+func (F *FIFO) NextEviction(key string, size uint64) string {
+	if size > F.size {
+		return key
 	}
-	return ""
+	return F.ruc.Back()
 }
 
-func (F *FIFO) Insert(key string) {
-	if !F.ruc.Has(key) {
-		F.ruc.InsertFront(key)
-		if F.ruc.Size() > F.size {
-			F.ruc.Remove(F.NextEviction(key))
+func (F *FIFO) Insert(key string, size uint64) {
+	if !F.ruc.Has(key) && size <= F.size {
+		for F.ruc.Weight+size > F.size {
+			F.ruc.Remove(F.ruc.Back())
 		}
+		F.ruc.InsertFront(key, size)
 	}
 }
 
@@ -123,12 +214,23 @@ func (F *FIFO) Contains(key string) bool {
 	return F.ruc.Has(key)
 }
 
+func (F *FIFO) Len() int {
+	return F.ruc.List.Len()
+}
+
+func (F *FIFO) Hit(key string) {
+}
+
 func (F *FIFO) Evict(key string) {
 	if F.ruc.Has(key) {
 		F.ruc.Remove(key)
 	}
 }
 
+// LRU evicts the least recently read key.  Before the Hit hook, reads did
+// not refresh a key and LRU evicted in insertion order, as FIFO does; LRU
+// results from before that change are FIFO results and do not compare with
+// later ones.
 type LRU struct {
 	size uint64
 	ruc  *RecentlyUsedCache
@@ -142,24 +244,26 @@ func NewLRU(capacity uint64) cache {
 }
 
 func (L *LRU) Warm() bool {
-	return L.ruc.Size() >= L.size
+	return L.ruc.Weight >= L.size
 }
 
-func (L *LRU) NextEviction(key string) string {
-	if L.ruc.List.Len() > 0 {
-		return L.ruc.List.Back().Value.(string)
+// NextEviction returns the oldest key even if there is room, as it always
+// has, so TinyLFU may turn away a key that would evict nothing.
+func (L *LRU) NextEviction(key string, size uint64) string {
+	if size > L.size {
+		return key
 	}
-	return ""
+	return L.ruc.Back()
 }
 
-func (L *LRU) Insert(key string) {
+func (L *LRU) Insert(key string, size uint64) {
 	if L.ruc.Has(key) {
 		L.ruc.MoveToFront(key)
-	} else {
-		L.ruc.InsertFront(key)
-		if L.ruc.Size() > L.size {
-			L.ruc.Remove(L.NextEviction(key))
+	} else if size <= L.size {
+		for L.ruc.Weight+size > L.size {
+			L.ruc.Remove(L.ruc.Back())
 		}
+		L.ruc.InsertFront(key, size)
 	}
 }
 
@@ -167,140 +271,346 @@ func (L *LRU) Contains(key string) bool {
 	return L.ruc.Has(key)
 }
 
+func (L *LRU) Len() int {
+	return L.ruc.List.Len()
+}
+
+func (L *LRU) Hit(key string) {
+	L.ruc.MoveToFront(key)
+}
+
 func (L *LRU) Evict(key string) {
 	if L.ruc.Has(key) {
 		L.ruc.Remove(key)
 	}
 }
 
-type OPT struct {
-	chosen map[string]struct{}
+// clairvoyant caches are told the position in the trace of each operation
+// before it is performed.
+type clairvoyant interface {
+	Seek(i int)
 }
 
-func NewOPT(capacity uint64, elements uint64) cache {
-	config := armnod.Configuration{
-		Charset:       armnod.Default,
-		StringChooser: armnod.InitializeFixedSet(elements),
-		LengthChooser: armnod.ConstantLengthChooser{8},
+// op is one operation of a trace: a read or a write of key.
+type op struct {
+	key  string
+	read bool
+	// size is the object's size in bytes, or zero if the trace has none
+	size uint64
+}
+
+// workload returns the trace to simulate and the length of its warmup.  A
+// replayed trace is cut to Operations operations after its warmup, and
+// objects it gives no size are sized as generated objects are.
+func workload(params parameters) ([]op, int) {
+	if params.Trace == "none" {
+		return generate(params)
 	}
-	G := config.Generator()
-	chosen := make(map[string]struct{})
-	for i := uint64(0); i < capacity; i++ {
-		s, ok := G.String()
-		if !ok {
-			panic("invariants broken")
+	ops, err := readTrace(params.Trace, params.TraceFormat)
+	if err != nil {
+		panic(err)
+	}
+	for i := range ops {
+		if ops[i].size == 0 {
+			ops[i].size = objectSize(params, ops[i].key)
 		}
-		chosen[s] = struct{}{}
 	}
-	return &OPT{
-		chosen: chosen,
+	w := warmupLength(ops, params)
+	if uint64(len(ops)-w) > params.Operations {
+		ops = ops[:w+int(params.Operations)]
 	}
+	return ops, w
 }
 
-func (O *OPT) Warm() bool {
-	return true
+// sharedWorkload is a workload built once for all the runs that simulate it.
+type sharedWorkload struct {
+	once   sync.Once
+	ops    []op
+	warmup int
 }
 
-func (O *OPT) NextEviction(key string) string {
-	if _, ok := O.chosen[key]; ok {
-		return ""
-	}
-	return key
-}
-
-func (O *OPT) Insert(key string) {
-}
-
-func (O *OPT) Contains(key string) bool {
-	_, ok := O.chosen[key]
-	return ok
+func (W *sharedWorkload) get(params parameters) ([]op, int) {
+	W.once.Do(func() {
+		W.ops, W.warmup = workload(params)
+		if params.SaveTrace != "none" {
+			if err := writeTrace(params.SaveTrace, W.ops); err != nil {
+				panic(err)
+			}
+		}
+	})
+	return W.ops, W.warmup
 }
 
-func (O *OPT) Evict(key string) {
+// workloadKey returns params with the settings that do not shape the
+// workload cleared, so that runs of the same workload have the same key.
+func workloadKey(params parameters) parameters {
+	params.UseTLFU = false
+	params.Memory = 0
+	params.Space = 0
+	params.Doorkeeper = 0
+	params.Sketch = ""
+	params.Aging = ""
+	params.Algorithm = ""
+	params.Window = 0
+	return params
 }
 
-func simulate(params parameters) result {
-	G := guacamole.New()
-	zp := guacamole.ZipfTheta(params.Objects, params.ZipfTheta)
-	A := armnod.Configuration{
-		Charset:       armnod.Default,
-		StringChooser: armnod.ChooseFromFixedSetZipf(zp),
-		LengthChooser: armnod.ConstantLengthChooser{8},
-	}.Generator()
-	T := tiny_lfu.New64(params.Memory, params.Space)
-	var C cache
+func newCache(params parameters, ops []op) cache {
 	switch params.Algorithm {
 	case "LRU":
-		C = NewLRU(params.CacheSize)
+		return NewLRU(params.capacity())
 	case "FIFO":
-		C = NewFIFO(params.CacheSize)
+		return NewFIFO(params.capacity())
 	case "OPT":
-		C = NewOPT(params.CacheSize, params.Objects)
+		return NewOPT(params.capacity(), ops)
+	case "ARC":
+		return NewARC(params.capacity())
+	case "LIRS":
+		return NewLIRS(params.capacity())
+	case "CLOCK":
+		return NewCLOCK(params.capacity())
+	case "CLOCK-Pro":
+		return NewCLOCKPro(params.capacity())
+	case "2Q":
+		return NewTwoQ(params.capacity())
+	case "SLRU":
+		return NewSLRU(params.capacity())
+	case "S3-FIFO":
+		return NewS3FIFO(params.capacity())
 	default:
 		panic("unknown cache algorithm")
 	}
-	R := result{}
-	G.Seed(params.Seed)
-	A.Seed(params.Seed)
-	for !C.Warm() {
-		s, ok := A.String()
-		if !ok {
-			panic("bad configuation: Objects must never exhaust")
+}
+
+func newSketch(params parameters) tiny_lfu.Sketch {
+	var opts []tiny_lfu.Option
+	if params.Aging != "default" {
+		opts = append(opts, tiny_lfu.WithAging(aging(params.Aging)))
+	}
+	if params.Doorkeeper > 0 {
+		opts = append(opts, tiny_lfu.WithDoorkeeper(params.Doorkeeper))
+	}
+	var T tiny_lfu.Sketch
+	var err error
+	switch params.Sketch {
+	case "TinyLFU32":
+		if params.Memory > math.MaxUint32 {
+			panic("memory too large for TinyLFU32")
 		}
-		C.Insert(s)
+		T, err = tiny_lfu.New32(uint32(params.Memory), params.Space, opts...)
+	case "TinyLFU64":
+		T, err = tiny_lfu.New64(params.Memory, params.Space, opts...)
+	case "TinyLFU4":
+		T, err = tiny_lfu.New4(params.Memory, params.Space, opts...)
+	case "TinyLFU8":
+		T, err = tiny_lfu.New8(params.Memory, params.Space, opts...)
+	default:
+		panic("unknown sketch")
 	}
-	for i := uint64(0); i < params.Operations; i++ {
-		s, ok := A.String()
-		if !ok {
-			panic("bad configuation: Objects must never exhaust")
+	if err != nil {
+		panic(err)
+	}
+	return T
+}
+
+func aging(name string) tiny_lfu.Aging {
+	switch name {
+	case "reset":
+		return tiny_lfu.AgingReset
+	case "incremental":
+		return tiny_lfu.AgingIncremental
+	case "continuous":
+		return tiny_lfu.AgingContinuous
+	case "none":
+		return tiny_lfu.AgingNone
+	default:
+		panic("unknown aging")
+	}
+}
+
+// simulate runs ops through the cache and returns the totals after warmup,
+// and a sample of each Window operations if Window is set.
+//
+// TinyLFU weighs a miss only against the first key NextEviction names.  When
+// sizes vary, the insert may evict more keys than that one, and those are
+// not weighed; Unweighed counts them, so that a large, cold key pushing out
+// many small, hot ones shows in the results.
+func simulate(params parameters, ops []op, warmup int) (result, []sample) {
+	// the sketch may be large, so runs without TinyLFU do without it
+	var T tiny_lfu.Sketch
+	if params.UseTLFU {
+		T = newSketch(params)
+	}
+	C := newCache(params, ops)
+	cv, _ := C.(clairvoyant)
+	R := result{}
+	var samples []sample
+	var last result
+	for i, o := range ops {
+		if cv != nil {
+			cv.Seek(i)
 		}
-		if G.Float64() < params.ReadRatio {
-			T.Tally(s)
+		s, size := o.key, params.cost(o)
+		if i < warmup && o.read {
+			C.Insert(s, size)
+		} else if i < warmup {
+			C.Evict(s)
+		} else if o.read {
+			if params.UseTLFU {
+				T.Tally(s)
+				R.Decimations = T.Decimations()
+			}
 			if C.Contains(s) {
+				C.Hit(s)
 				R.Hits++
-			} else if params.UseTLFU {
-				victim := C.NextEviction(s)
-				if T.ShouldReplace(victim, s) {
-					R.Inserts++
-					C.Insert(s)
-				}
+				R.HitBytes += o.size
 			} else {
-				R.Inserts++
-				C.Insert(s)
+				// a victim of s itself means the cache declines s
+				n := C.Len()
+				victim := C.NextEviction(s, size)
+				if victim != s && (victim == "" || !params.UseTLFU || T.ShouldReplace(victim, s)) {
+					// Insert may still decline s, e.g. when OPT finds
+					// s worth less than the keys left after a victim
+					C.Insert(s, size)
+					evicted := n - C.Len()
+					if C.Contains(s) {
+						R.Inserts++
+						evicted++
+					}
+					R.Evictions += uint64(evicted)
+					if params.UseTLFU && victim != "" && evicted > 1 {
+						R.Unweighed += uint64(evicted - 1)
+					}
+				} else if victim != s {
+					R.Rejections++
+				}
 			}
 			R.Reads++
+			R.ReadBytes += o.size
 		} else {
 			C.Evict(s)
 			R.Writes++
 		}
+		if t := uint64(i + 1 - warmup); i >= warmup && params.Window > 0 && (t%params.Window == 0 || i+1 == len(ops)) {
+			samples = append(samples, window(R, last, t))
+			last = R
+		}
+	}
+	if R.ReadBytes > 0 {
+		R.ByteHitRatio = float64(R.HitBytes) / float64(R.ReadBytes)
+	}
+	return R, samples
+}
+
+// window returns the sample of the operations between last and R, which
+// ends t operations after warmup.
+func window(R, last result, t uint64) sample {
+	s := sample{
+		Operations:  t,
+		Reads:       R.Reads - last.Reads,
+		Hits:        R.Hits - last.Hits,
+		Rejections:  R.Rejections - last.Rejections,
+		Evictions:   R.Evictions - last.Evictions,
+		Unweighed:   R.Unweighed - last.Unweighed,
+		Decimations: R.Decimations - last.Decimations,
 	}
-	return R
+	if s.Reads > 0 {
+		s.HitRatio = float64(s.Hits) / float64(s.Reads)
+	}
+	return s
 }
 
 func main() {
 	params := parameters{
-		Operations: 4e6,
-		ReadRatio:  0.99,
-		Objects:    1e10,
-		ZipfTheta:  0.9,
-		Seed:       0,
-		Memory:     1e6,
-		Space:      1e8,
-		Algorithm:  "LRU",
-		CacheSize:  1e6,
+		Operations:    4e6,
+		ReadRatio:     0.99,
+		Objects:       1e10,
+		ZipfTheta:     0.9,
+		Seed:          0,
+		Trace:         "none",
+		TraceFormat:   "keys",
+		Sizes:         "constant",
+		MeanSize:      4096,
+		ShiftBy:       1e3,
+		ScanLength:    1e4,
+		LoopLength:    1e4,
+		StackDistance: 100,
+		SaveTrace:     "none",
+		Memory:        1e6,
+		Space:         1e8,
+		Sketch:        "TinyLFU64",
+		Aging:         "default",
+		Algorithm:     "LRU",
+		CacheSize:     1e6,
 	}
 	var results result
 
 	// setup
-	ubench.AddFlags(&params)
+	sweep := ubench.AddSweepFlags(&params)
+	workers := flag.Int("workers", runtime.GOMAXPROCS(0), "number of simulations to run at once")
+	if err := flag.Set(ubench.FieldNameToFlag("UseTLFU"), "false,true"); err != nil {
+		panic(err)
+	}
 	flag.Parse()
-	ubench.PrintCommentString(params, results)
-	// run without tlfu
-	params.UseTLFU = false
-	results = simulate(params)
-	ubench.PrintResultString(params, results)
-	// run with tlfu
-	params.UseTLFU = true
-	results = simulate(params)
-	ubench.PrintResultString(params, results)
+	runs := sweep.Expand()
+	workloads := make(map[parameters]*sharedWorkload)
+	saving, series, totals := false, false, false
+	for _, run := range runs {
+		if run.(parameters).MeanSize == 0 {
+			panic("mean size must be at least one byte")
+		}
+		key := workloadKey(run.(parameters))
+		if workloads[key] == nil {
+			workloads[key] = &sharedWorkload{}
+		}
+		saving = saving || key.SaveTrace != "none"
+		series = series || run.(parameters).Window > 0
+		totals = totals || run.(parameters).Window == 0
+	}
+	if saving && len(workloads) > 1 {
+		panic("cannot save the trace of more than one workload")
+	}
+	if series && totals {
+		panic("cannot sweep window between zero and a positive size")
+	}
+	if series {
+		ubench.PrintCommentString(params, sample{})
+	} else {
+		ubench.PrintCommentString(params, results)
+	}
+	// run on a pool of workers, printing rows in the order of the sweep
+	type row struct {
+		R       result
+		samples []sample
+	}
+	rows := make([]chan row, len(runs))
+	for i := range rows {
+		rows[i] = make(chan row, 1)
+	}
+	next := make(chan int)
+	go func() {
+		for i := range runs {
+			next <- i
+		}
+		close(next)
+	}()
+	for w := 0; w < max(1, *workers); w++ {
+		go func() {
+			for i := range next {
+				p := runs[i].(parameters)
+				ops, warmup := workloads[workloadKey(p)].get(p)
+				R, samples := simulate(p, ops, warmup)
+				rows[i] <- row{R, samples}
+			}
+		}()
+	}
+	for i, run := range runs {
+		r := <-rows[i]
+		if !series {
+			ubench.PrintResultString(run, r.R)
+		}
+		for _, s := range r.samples {
+			ubench.PrintResultString(run, s)
+		}
+	}
 }
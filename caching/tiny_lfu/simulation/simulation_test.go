@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulateEvictions(t *testing.T) {
+	require := require.New(t)
+
+	// without TinyLFU no sketch is built, so none need be configured
+	params := parameters{
+		Algorithm:  "OPT",
+		CacheBytes: 10,
+	}
+	// z evicts x, which is read after it, and then is declined because y
+	// is read before it
+	ops := reads("xyzyzx")
+	for i, size := range []uint64{5, 5, 8, 5, 8, 5} {
+		ops[i].size = size
+	}
+	R, _ := simulate(params, ops, 0)
+	require.Equal(uint64(6), R.Reads)
+	require.Equal(uint64(1), R.Hits)
+	require.Equal(uint64(3), R.Inserts)
+	require.Equal(uint64(1), R.Evictions)
+	require.Zero(R.Rejections)
+}
+
+func TestSimulateUnweighed(t *testing.T) {
+	require := require.New(t)
+
+	params := parameters{
+		UseTLFU:    true,
+		Sketch:     "TinyLFU64",
+		Aging:      "default",
+		Memory:     100,
+		Space:      1e4,
+		Algorithm:  "CLOCK",
+		CacheBytes: 10,
+	}
+	// b loses to x once, then wins and evicts y and z without being
+	// weighed against them
+	ops := reads("xyzbb")
+	for i, size := range []uint64{3, 3, 3, 9, 9} {
+		ops[i].size = size
+	}
+	R, _ := simulate(params, ops, 0)
+	require.Equal(uint64(4), R.Inserts)
+	require.Equal(uint64(1), R.Rejections)
+	require.Equal(uint64(3), R.Evictions)
+	require.Equal(uint64(2), R.Unweighed)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+)
+
+// objectSize draws the size of key's object from the Sizes distribution
+// with mean MeanSize.  The draw is seeded by key and Seed, so that each key
+// has one size throughout a simulation.
+func objectSize(params parameters, key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	r := rand.New(rand.NewPCG(h.Sum64(), params.Seed))
+	mean := float64(params.MeanSize)
+	var x float64
+	switch params.Sizes {
+	case "constant":
+		x = mean
+	case "uniform":
+		x = 1 + r.Float64()*(2*mean-2)
+	case "exponential":
+		x = r.ExpFloat64() * mean
+	case "pareto":
+		// alpha of 1.5 gives a heavy tail with a finite mean
+		const alpha = 1.5
+		xm := mean * (alpha - 1) / alpha
+		x = xm / math.Pow(1-r.Float64(), 1/alpha)
+	case "lognormal":
+		// sigma of 1 spreads sizes over about two orders of magnitude
+		const sigma = 1.0
+		x = math.Exp(math.Log(mean) - sigma*sigma/2 + sigma*r.NormFloat64())
+	default:
+		panic("unknown size distribution")
+	}
+	return max(1, uint64(math.Round(x)))
+}
@@ -0,0 +1,77 @@
+package main
+
+// SLRU is a segmented LRU.  New keys enter the probationary segment and a
+// hit promotes them to the protected segment, which holds 80% of the cache
+// and demotes its least recent key back to probation when it overflows.
+type SLRU struct {
+	size          uint64
+	protectedSize uint64
+	probation     *RecentlyUsedCache
+	protected     *RecentlyUsedCache
+}
+
+func NewSLRU(capacity uint64) cache {
+	return &SLRU{
+		size:          capacity,
+		protectedSize: capacity * 8 / 10,
+		probation:     NewRUC(),
+		protected:     NewRUC(),
+	}
+}
+
+func (S *SLRU) Warm() bool {
+	return S.probation.Weight+S.protected.Weight >= S.size
+}
+
+func (S *SLRU) NextEviction(key string, size uint64) string {
+	if size > S.size {
+		return key
+	}
+	if S.probation.Weight+S.protected.Weight+size <= S.size {
+		return ""
+	}
+	if S.probation.List.Len() > 0 {
+		return S.probation.Back()
+	}
+	return S.protected.Back()
+}
+
+func (S *SLRU) Insert(key string, size uint64) {
+	if S.Contains(key) {
+		S.Hit(key)
+		return
+	}
+	if size > S.size {
+		return
+	}
+	for S.probation.Weight+S.protected.Weight+size > S.size {
+		victim := S.NextEviction(key, size)
+		S.probation.Remove(victim)
+		S.protected.Remove(victim)
+	}
+	S.probation.InsertFront(key, size)
+}
+
+func (S *SLRU) Contains(key string) bool {
+	return S.probation.Has(key) || S.protected.Has(key)
+}
+
+func (S *SLRU) Len() int {
+	return S.probation.List.Len() + S.protected.List.Len()
+}
+
+func (S *SLRU) Hit(key string) {
+	if S.protected.Has(key) {
+		S.protected.MoveToFront(key)
+		return
+	}
+	S.probation.MoveTo(key, S.protected)
+	for S.protected.Weight > S.protectedSize && S.protected.List.Len() > 1 {
+		S.protected.MoveTo(S.protected.Back(), S.probation)
+	}
+}
+
+func (S *SLRU) Evict(key string) {
+	S.probation.Remove(key)
+	S.protected.Remove(key)
+}
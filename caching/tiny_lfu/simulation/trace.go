@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Trace formats:
+//
+//	keys    one key per line, each a read
+//	lirs    one block number per line, each a read, as in the LIRS traces
+//	arc     "start count ignored request" per line, a read of each of the
+//	        count blocks from start, as in the ARC traces
+//	csv     "op,key,size" per line, where op is read, get, write, set, or
+//	        delete, and an optional header line names the columns
+//	binary  records of a uvarint length<<1|write, the key, and a uvarint
+//	        size, after the eight bytes of traceMagic
+const traceMagic = "HSTRACE1"
+
+var BadTrace = errors.New("simulation: bad trace")
+
+// maxTraceKey bounds the key length a binary trace may claim, so a corrupt
+// length fails as BadTrace rather than as an allocation.
+const maxTraceKey = 1 << 20
+
+// readTrace reads the trace at path in the given format.
+func readTrace(path, format string) ([]op, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	switch format {
+	case "keys":
+		return readLines(r, parseKey)
+	case "lirs":
+		return readLines(r, parseLIRS)
+	case "arc":
+		return readLines(r, parseARC)
+	case "csv":
+		return readLines(r, parseCSV)
+	case "binary":
+		return readBinary(r)
+	default:
+		return nil, fmt.Errorf("unknown trace format %q", format)
+	}
+}
+
+// readLines parses each non-blank line of r into zero or more operations.
+// The parser learns whether the line is the first non-blank one, which is
+// where a header may sit.
+func readLines(r io.Reader, parse func(ops []op, line string, lineno int, first bool) ([]op, error)) ([]op, error) {
+	var ops []op
+	s := bufio.NewScanner(r)
+	first := true
+	for lineno := 1; s.Scan(); lineno++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		var err error
+		ops, err = parse(ops, line, lineno, first)
+		if err != nil {
+			return nil, err
+		}
+		first = false
+	}
+	return ops, s.Err()
+}
+
+func parseKey(ops []op, line string, lineno int, first bool) ([]op, error) {
+	return append(ops, op{key: line, read: true}), nil
+}
+
+func parseLIRS(ops []op, line string, lineno int, first bool) ([]op, error) {
+	block, err := strconv.ParseUint(line, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: line %d: %v", BadTrace, lineno, err)
+	}
+	return append(ops, op{key: strconv.FormatUint(block, 10), read: true}), nil
+}
+
+func parseARC(ops []op, line string, lineno int, first bool) ([]op, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("%w: line %d: want start and count", BadTrace, lineno)
+	}
+	start, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: line %d: %v", BadTrace, lineno, err)
+	}
+	count, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: line %d: %v", BadTrace, lineno, err)
+	}
+	for i := uint64(0); i < count; i++ {
+		ops = append(ops, op{key: strconv.FormatUint(start+i, 10), read: true})
+	}
+	return ops, nil
+}
+
+func parseCSV(ops []op, line string, lineno int, first bool) ([]op, error) {
+	fields := strings.Split(line, ",")
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("%w: line %d: want op,key,size", BadTrace, lineno)
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	if first && strings.EqualFold(fields[0], "op") {
+		return ops, nil
+	}
+	size, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: line %d: %v", BadTrace, lineno, err)
+	}
+	o := op{key: fields[1], size: size}
+	switch strings.ToLower(fields[0]) {
+	case "read", "get":
+		o.read = true
+	case "write", "set", "delete":
+	default:
+		return nil, fmt.Errorf("%w: line %d: unknown op %q", BadTrace, lineno, fields[0])
+	}
+	return append(ops, o), nil
+}
+
+func readBinary(r *bufio.Reader) ([]op, error) {
+	magic := make([]byte, len(traceMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != traceMagic {
+		return nil, fmt.Errorf("%w: missing magic", BadTrace)
+	}
+	var ops []op
+	for {
+		h, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			return ops, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: record %d: %v", BadTrace, len(ops), err)
+		}
+		if h>>1 > maxTraceKey {
+			return nil, fmt.Errorf("%w: record %d: key too long", BadTrace, len(ops))
+		}
+		key := make([]byte, h>>1)
+		if _, err := io.ReadFull(r, key); err != nil {
+			return nil, fmt.Errorf("%w: record %d: %v", BadTrace, len(ops), err)
+		}
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: record %d: %v", BadTrace, len(ops), err)
+		}
+		ops = append(ops, op{key: string(key), read: h&1 == 0, size: size})
+	}
+}
+
+// writeTrace writes ops to path in the binary format.
+func writeTrace(path string, ops []op) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	w.WriteString(traceMagic)
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, o := range ops {
+		h := uint64(len(o.key)) << 1
+		if !o.read {
+			h |= 1
+		}
+		w.Write(buf[:binary.PutUvarint(buf, h)])
+		w.WriteString(o.key)
+		w.Write(buf[:binary.PutUvarint(buf, o.size)])
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// warmupLength returns the length of the shortest prefix of ops whose reads
+// touch distinct keys enough to fill the cache, or zero if ops never do.
+func warmupLength(ops []op, params parameters) int {
+	seen := make(map[string]struct{})
+	filled := uint64(0)
+	for i, o := range ops {
+		if _, ok := seen[o.key]; o.read && !ok {
+			seen[o.key] = struct{}{}
+			filled += params.cost(o)
+		}
+		if filled >= params.capacity() {
+			return i + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeys(t *testing.T) {
+	require := require.New(t)
+
+	ops, err := readLines(strings.NewReader("a\n\n b \nc\n"), parseKey)
+	require.NoError(err)
+	require.Equal(reads("abc"), ops)
+}
+
+func TestParseLIRS(t *testing.T) {
+	require := require.New(t)
+
+	ops, err := readLines(strings.NewReader("3\n007\n"), parseLIRS)
+	require.NoError(err)
+	require.Equal([]op{{key: "3", read: true}, {key: "7", read: true}}, ops)
+	_, err = readLines(strings.NewReader("3\nx\n"), parseLIRS)
+	require.ErrorIs(err, BadTrace)
+	require.Contains(err.Error(), "line 2")
+}
+
+func TestParseARC(t *testing.T) {
+	require := require.New(t)
+
+	ops, err := readLines(strings.NewReader("10 3 0 1\n5 1 0 2\n"), parseARC)
+	require.NoError(err)
+	require.Equal([]op{
+		{key: "10", read: true},
+		{key: "11", read: true},
+		{key: "12", read: true},
+		{key: "5", read: true},
+	}, ops)
+	_, err = readLines(strings.NewReader("10\n"), parseARC)
+	require.ErrorIs(err, BadTrace)
+}
+
+func TestParseCSV(t *testing.T) {
+	require := require.New(t)
+
+	trace := "op,key,size\nget,a,10\nSET, b, 20\ndelete,a,0\nread,b,20\n"
+	ops, err := readLines(strings.NewReader(trace), parseCSV)
+	require.NoError(err)
+	require.Equal([]op{
+		{key: "a", read: true, size: 10},
+		{key: "b", size: 20},
+		{key: "a"},
+		{key: "b", read: true, size: 20},
+	}, ops)
+	ops, err = readLines(strings.NewReader("\n\nop,key,size\nget,a,10\n"), parseCSV)
+	require.NoError(err)
+	require.Equal([]op{{key: "a", read: true, size: 10}}, ops)
+	for _, bad := range []string{"put,a,1\n", "get,a\n", "get,a,big\n", "get,a,1\nop,key,size\n"} {
+		_, err = readLines(strings.NewReader(bad), parseCSV)
+		require.ErrorIs(err, BadTrace, bad)
+	}
+}
+
+func TestBinaryTrace(t *testing.T) {
+	require := require.New(t)
+
+	ops := []op{
+		{key: "a", read: true, size: 10},
+		{key: "", read: true},
+		{key: strings.Repeat("b", 200), size: 1 << 40},
+		{key: "a", read: true, size: 10},
+	}
+	path := filepath.Join(t.TempDir(), "trace")
+	require.NoError(writeTrace(path, ops))
+	got, err := readTrace(path, "binary")
+	require.NoError(err)
+	require.Equal(ops, got)
+	_, err = readTrace(path, "lirs")
+	require.ErrorIs(err, BadTrace)
+
+	require.NoError(writeTrace(path, nil))
+	got, err = readTrace(path, "binary")
+	require.NoError(err)
+	require.Empty(got)
+	_, err = readTrace(path+".missing", "binary")
+	require.Error(err)
+
+	huge := traceMagic + string(binary.AppendUvarint(nil, 1<<62))
+	_, err = readBinary(bufio.NewReader(strings.NewReader(huge)))
+	require.ErrorIs(err, BadTrace)
+}
+
+func TestWarmupLength(t *testing.T) {
+	require := require.New(t)
+
+	ops := reads("aabbcd")
+	ops[2].read = false
+	for i := range ops {
+		ops[i].size = uint64(i + 1)
+	}
+	// the write of b does not warm the cache
+	require.Equal(5, warmupLength(ops, parameters{CacheSize: 3}))
+	require.Equal(0, warmupLength(ops, parameters{CacheSize: 5}))
+	// by size, a and the read of b at 3 fill 5 bytes
+	require.Equal(4, warmupLength(ops, parameters{CacheBytes: 5}))
+}
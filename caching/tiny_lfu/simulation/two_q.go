@@ -0,0 +1,96 @@
+package main
+
+// TwoQ is Johnson and Shasha's full 2Q.  New keys enter the A1in FIFO, and
+// keys evicted from it are remembered in the A1out ghost FIFO.  A miss on a
+// remembered key promotes it to the Am LRU.
+type TwoQ struct {
+	size  uint64
+	kin   uint64
+	kout  uint64
+	a1in  *RecentlyUsedCache
+	a1out *RecentlyUsedCache
+	am    *RecentlyUsedCache
+}
+
+// NewTwoQ sizes A1in at a quarter of the cache and A1out at half, as the
+// paper recommends.
+func NewTwoQ(capacity uint64) cache {
+	return &TwoQ{
+		size:  capacity,
+		kin:   max(1, capacity/4),
+		kout:  max(1, capacity/2),
+		a1in:  NewRUC(),
+		a1out: NewRUC(),
+		am:    NewRUC(),
+	}
+}
+
+func (Q *TwoQ) Warm() bool {
+	return Q.a1in.Weight+Q.am.Weight >= Q.size
+}
+
+func (Q *TwoQ) NextEviction(key string, size uint64) string {
+	if size > Q.size {
+		return key
+	}
+	if Q.a1in.Weight+Q.am.Weight+size <= Q.size {
+		return ""
+	}
+	return Q.victim().Back()
+}
+
+func (Q *TwoQ) Insert(key string, size uint64) {
+	if Q.Contains(key) {
+		Q.Hit(key)
+		return
+	}
+	if size > Q.size {
+		return
+	}
+	for Q.a1in.Weight+Q.am.Weight+size > Q.size {
+		from := Q.victim()
+		victim := from.Back()
+		if from == Q.am {
+			Q.am.Remove(victim)
+			continue
+		}
+		Q.a1in.MoveTo(victim, Q.a1out)
+		for Q.a1out.Weight > Q.kout {
+			Q.a1out.Remove(Q.a1out.Back())
+		}
+	}
+	if Q.a1out.Has(key) {
+		Q.a1out.Remove(key)
+		Q.am.InsertFront(key, size)
+	} else {
+		Q.a1in.InsertFront(key, size)
+	}
+}
+
+func (Q *TwoQ) Contains(key string) bool {
+	return Q.a1in.Has(key) || Q.am.Has(key)
+}
+
+func (Q *TwoQ) Len() int {
+	return Q.a1in.List.Len() + Q.am.List.Len()
+}
+
+func (Q *TwoQ) Hit(key string) {
+	if Q.am.Has(key) {
+		Q.am.MoveToFront(key)
+	}
+}
+
+func (Q *TwoQ) Evict(key string) {
+	Q.a1in.Remove(key)
+	Q.a1out.Remove(key)
+	Q.am.Remove(key)
+}
+
+// victim returns the list the next eviction comes from.
+func (Q *TwoQ) victim() *RecentlyUsedCache {
+	if Q.a1in.Weight > Q.kin || Q.am.List.Len() == 0 {
+		return Q.a1in
+	}
+	return Q.am
+}
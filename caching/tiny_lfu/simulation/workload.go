@@ -0,0 +1,153 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+
+	"hack.systems/random/guacamole"
+
+	"hack.systems/util/caching/tiny_lfu"
+)
+
+// generator draws the keys of a synthetic workload.  Each operation comes
+// from the first source that claims it:
+//
+//	scan      a burst of ScanLength keys read once, at the end of every
+//	          ScanEvery operations
+//	loop      the next of LoopLength keys read in order over and over, with
+//	          probability LoopRatio
+//	locality  a key used recently, at a stack distance with mean
+//	          StackDistance, with probability LocalityRatio
+//	popular   a key by Zipf rank, where the ranks rotate by ShiftBy every
+//	          ShiftEvery operations, and over each DiurnalPeriod operations
+//	          draws shift from one set of popular keys to a second and back
+type generator struct {
+	params parameters
+	G      *guacamole.Guacamole
+	zipf   *guacamole.ZipfParams
+	scans  uint64
+	loops  uint64
+	// recent is the stack of distinct keys in order of last use
+	recent *list.List
+	elems  map[string]*list.Element
+}
+
+func newGenerator(params parameters) *generator {
+	g := &generator{
+		params: params,
+		G:      guacamole.New(),
+		zipf:   guacamole.ZipfTheta(params.Objects, params.ZipfTheta),
+		recent: list.New(),
+		elems:  make(map[string]*list.Element),
+	}
+	g.G.Seed(params.Seed)
+	return g
+}
+
+// next returns operation t, counting from the end of warmup.  Scans only
+// read, and other operations read with probability ReadRatio.
+func (g *generator) next(t uint64) op {
+	p := g.params
+	var key string
+	switch {
+	case p.ScanEvery > 0 && t%p.ScanEvery >= p.ScanEvery-min(p.ScanEvery, p.ScanLength):
+		key = "scan:" + objectKey(g.scans)
+		g.scans++
+		g.use(key)
+		return op{key: key, read: true}
+	case p.LoopLength > 0 && g.G.Float64() < p.LoopRatio:
+		key = "loop:" + objectKey(g.loops%p.LoopLength)
+		g.loops++
+	default:
+		var ok bool
+		if key, ok = g.local(); !ok {
+			key = g.popular(t)
+		}
+	}
+	g.use(key)
+	return op{key: key, read: g.G.Float64() < p.ReadRatio}
+}
+
+// local returns a recently used key with probability LocalityRatio.
+func (g *generator) local() (string, bool) {
+	p := g.params
+	if p.StackDistance == 0 || g.G.Float64() >= p.LocalityRatio {
+		return "", false
+	}
+	// a geometric depth with mean StackDistance
+	q := 1 / float64(p.StackDistance+1)
+	depth := uint64(math.Log(1-g.G.Float64()) / math.Log(1-q))
+	if depth >= uint64(g.recent.Len()) {
+		return "", false
+	}
+	elem := g.recent.Front()
+	for i := uint64(0); i < depth; i++ {
+		elem = elem.Next()
+	}
+	return elem.Value.(string), true
+}
+
+// popular returns a key by Zipf rank as of operation t.
+func (g *generator) popular(t uint64) string {
+	p := g.params
+	rank := g.G.Zipf(g.zipf)
+	if p.DiurnalPeriod > 0 {
+		phase := 2 * math.Pi * float64(t%p.DiurnalPeriod) / float64(p.DiurnalPeriod)
+		if g.G.Float64() < (1-math.Cos(phase))/2 {
+			rank += p.Objects / 2
+		}
+	}
+	if p.ShiftEvery > 0 {
+		rank += t / p.ShiftEvery * p.ShiftBy
+	}
+	return objectKey(rank % p.Objects)
+}
+
+// objectKey names the object of a rank.  Names are scrambled ranks, so that
+// they look like the random keys of a real workload.
+func objectKey(rank uint64) string {
+	return fmt.Sprintf("%016x", tiny_lfu.HashInteger(rank))
+}
+
+// use moves key to the top of the stack of recent keys, which holds enough
+// keys for nearly every draw of local.
+func (g *generator) use(key string) {
+	if g.params.LocalityRatio <= 0 {
+		return
+	}
+	if elem, ok := g.elems[key]; ok {
+		g.recent.MoveToFront(elem)
+		return
+	}
+	g.elems[key] = g.recent.PushFront(key)
+	if uint64(g.recent.Len()) > 16*g.params.StackDistance {
+		delete(g.elems, g.recent.Remove(g.recent.Back()).(string))
+	}
+}
+
+// generate returns the trace to simulate.  It begins with a warmup of reads
+// of popular keys whose distinct keys together fill any cache, and the
+// first warm operations follow.
+func generate(params parameters) ([]op, int) {
+	g := newGenerator(params)
+	var ops []op
+	seen := make(map[string]struct{})
+	for filled := uint64(0); filled < params.capacity(); {
+		o := op{key: g.popular(0), read: true}
+		g.use(o.key)
+		o.size = objectSize(params, o.key)
+		if _, ok := seen[o.key]; !ok {
+			seen[o.key] = struct{}{}
+			filled += params.cost(o)
+		}
+		ops = append(ops, o)
+	}
+	warmup := len(ops)
+	for t := uint64(0); t < params.Operations; t++ {
+		o := g.next(t)
+		o.size = objectSize(params, o.key)
+		ops = append(ops, o)
+	}
+	return ops, warmup
+}
@@ -0,0 +1,124 @@
+package tiny_lfu
+
+import (
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+)
+
+// stripes spreads a sketch's sample counter over padded cells so that
+// concurrent tallies do not all add to one shared word.  Each cell publishes
+// its tallies to the shared counter a batch at a time.  At most one batch per
+// cell is ever unpublished, and batches are sized so that this delays a
+// decimation by no more than 1/64th of the sketch's memory.
+type stripes struct {
+	cells []stripe
+	batch uint64
+}
+
+// stripe is padded to a cache line so cells do not share one.
+type stripe struct {
+	n uint64
+	_ [56]byte
+}
+
+// newStripes returns the stripes requested by o, or nil.
+func newStripes(memory uint64, o options) *stripes {
+	if o.stripes == 0 {
+		return nil
+	}
+	return &stripes{
+		cells: make([]stripe, o.stripes),
+		batch: max(1, memory/64/uint64(o.stripes)),
+	}
+}
+
+// reset returns empty stripes with as many cells as s, batched for memory.
+func (s *stripes) reset(memory uint64) *stripes {
+	if s == nil {
+		return nil
+	}
+	return newStripes(memory, options{stripes: len(s.cells)})
+}
+
+// add records n tallies and returns how many to publish to the shared
+// counter now, which is zero until a cell fills its batch.  A nil stripes
+// publishes every tally immediately.  The cell is chosen at random, as
+// Buffer chooses a shard, so that even tallies of one hot key spread over
+// every cell.
+func (s *stripes) add(n uint64) uint64 {
+	if s == nil {
+		return n
+	}
+	c := &s.cells[rand.IntN(len(s.cells))]
+	if atomic.AddUint64(&c.n, n) < s.batch {
+		return 0
+	}
+	return atomic.SwapUint64(&c.n, 0)
+}
+
+// Buffer collects tallies in shards and applies them to a sketch in batches,
+// so that goroutines tallying at once rarely touch the sketch's counters at
+// the same time.  Tallies are invisible to the sketch until their shard
+// drains or Flush is called.  A tally that finds its shard busy goes
+// straight to the sketch rather than wait.
+type Buffer struct {
+	sketch Sketch
+	shards []bufferShard
+}
+
+type bufferShard struct {
+	mtx    sync.Mutex
+	hashes []uint64
+	_      [32]byte
+}
+
+// NewBuffer buffers tallies to sketch in the given number of shards of size
+// hashes each.  It panics if either is not positive.
+func NewBuffer(sketch Sketch, shards, size int) *Buffer {
+	if shards <= 0 || size <= 0 {
+		panic("tiny_lfu: buffer shards and size must be positive")
+	}
+	b := &Buffer{
+		sketch: sketch,
+		shards: make([]bufferShard, shards),
+	}
+	for i := range b.shards {
+		b.shards[i].hashes = make([]uint64, 0, size)
+	}
+	return b
+}
+
+func (b *Buffer) Tally(key string) {
+	b.TallyHash(b.sketch.Hash(key))
+}
+
+func (b *Buffer) TallyHash(key uint64) {
+	s := &b.shards[rand.IntN(len(b.shards))]
+	if !s.mtx.TryLock() {
+		b.sketch.TallyHash(key)
+		return
+	}
+	defer s.mtx.Unlock()
+	s.hashes = append(s.hashes, key)
+	if len(s.hashes) == cap(s.hashes) {
+		s.drain(b.sketch)
+	}
+}
+
+// Flush applies every buffered tally to the sketch.
+func (b *Buffer) Flush() {
+	for i := range b.shards {
+		s := &b.shards[i]
+		s.mtx.Lock()
+		s.drain(b.sketch)
+		s.mtx.Unlock()
+	}
+}
+
+func (s *bufferShard) drain(sketch Sketch) {
+	for _, h := range s.hashes {
+		sketch.TallyHash(h)
+	}
+	s.hashes = s.hashes[:0]
+}
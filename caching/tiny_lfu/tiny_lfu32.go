@@ -1,8 +1,6 @@
 package tiny_lfu
 
 import (
-	"encoding/binary"
-	"hash/fnv"
 	"math"
 	"sync"
 	"sync/atomic"
@@ -10,53 +8,108 @@ import (
 	"hack.systems/util/bloom"
 )
 
+const decimationBlock = 4096
+
 type TinyLFU32 struct {
 	memory  uint32
 	counter uint32
 	epoch   uint64
+	aging   Aging
 	keys    uint
 	counts  []uint32
+	door    *bloom.Concurrent
+	stripes *stripes
+	blocks  []uint64
+	hasher  Hasher
 	mtx     sync.Mutex
 }
 
-func New32(memory uint32, space uint64) *TinyLFU32 {
-	N := float64(memory)
-	M := float64(space) / 4
-	P := bloom.BloomParamsP(N, M)
-	if P < minP {
-		P = minP
-		M = bloom.BloomParamsM(N, P)
-		if M*4 > float64(space) {
-			panic("error in bloom parameter calculations")
-		}
+// New32 returns a sketch that halves its counters every memory tallies and
+// uses at most space bytes of 32-bit counters.  It supports AgingReset and
+// AgingIncremental.
+func New32(memory uint32, space uint64, opts ...Option) (*TinyLFU32, error) {
+	o := makeOptions(opts)
+	if o.aging != AgingReset && o.aging != AgingIncremental {
+		return nil, BadAging
+	}
+	counts, keys, err := size(uint64(memory), space, 32, o)
+	if err != nil {
+		return nil, err
 	}
-	K := bloom.KeysForProbability(P)
-	counts := uint64(M)
-	return &TinyLFU32{
-		memory: memory,
-		keys:   uint(math.Ceil(K)),
-		counts: make([]uint32, counts),
+	t := &TinyLFU32{
+		memory:  memory,
+		aging:   o.aging,
+		keys:    keys,
+		counts:  make([]uint32, counts),
+		door:    doorkeeper(uint64(memory), o),
+		stripes: newStripes(uint64(memory), o),
+		hasher:  o.hasher,
 	}
+	if t.aging == AgingIncremental {
+		t.blocks = make([]uint64, (counts+decimationBlock-1)/decimationBlock)
+	}
+	return t, nil
 }
 
 func (t *TinyLFU32) Tally(key string) {
-	h := t.hash(key)
-	for i := uint(0); i < t.keys; i++ {
-		atomic.AddUint32(&t.counts[h[i]], 1)
+	t.strings().Tally(key)
+}
+
+func (t *TinyLFU32) TallyHash(key uint64) {
+	t.TallyNHash(key, 1)
+}
+
+func (t *TinyLFU32) TallyN(key string, n uint64) {
+	t.strings().TallyN(key, n)
+}
+
+// TallyNHash records n occurrences of key, saturating its counters.  A
+// weight above memory ages the sketch only as much as memory tallies would.
+func (t *TinyLFU32) TallyNHash(key uint64, n uint64) {
+	if n == 0 {
+		return
 	}
-	if atomic.AddUint32(&t.counter, 1) == t.memory {
+	if x := admit(t.door, key, n); x > 0 {
+		h1, h2 := bloom.Derive(key)
+		mod := uint64(len(t.counts))
+		for i := uint(0); i < t.keys; i++ {
+			addSaturating(&t.counts[probe(h1, h2, i, mod)], x)
+		}
+	}
+	n = t.stripes.add(min(n, uint64(t.memory)))
+	if n == 0 {
+		return
+	}
+	sum := atomic.AddUint32(&t.counter, uint32(n))
+	if crossed(uint64(sum), n, uint64(t.memory)) {
 		t.decimate()
 	}
 }
 
+func (t *TinyLFU32) Estimate(key string) uint64 {
+	return t.strings().Estimate(key)
+}
+
+func (t *TinyLFU32) EstimateHash(key uint64) uint64 {
+	for {
+		count, epoch := t.read(key)
+		if epoch&0x1 == 0 {
+			return uint64(count)
+		}
+	}
+}
+
 func (t *TinyLFU32) ShouldReplace(victim, candidate string) bool {
-	hv := t.hash(victim)
-	hc := t.hash(candidate)
-	// TODO(rescrv):  This will spin during a decimation to keep results
-	// correct.  Maybe allow it to give incorrect results in constant time.
+	return t.strings().ShouldReplace(victim, candidate)
+}
+
+func (t *TinyLFU32) ShouldReplaceHash(victim, candidate uint64) bool {
+	// With AgingReset this spins for the length of a decimation to keep
+	// results correct.  AgingIncremental never has an odd epoch, and spins
+	// only if a decimation begins between the two reads.
 	for {
-		vCount, vEpoch := t.read(hv)
-		cCount, cEpoch := t.read(hc)
+		vCount, vEpoch := t.read(victim)
+		cCount, cEpoch := t.read(candidate)
 		if vEpoch == cEpoch {
 			// this is the conditional to not take for incorrect results
 			if cEpoch&0x1 == 1 {
@@ -67,50 +120,151 @@ func (t *TinyLFU32) ShouldReplace(victim, candidate string) bool {
 	}
 }
 
-func (t *TinyLFU32) hash(key string) [4]uint64 {
-	buf := make([]byte, 0, 32)
-	h := [4]uint64{}
-	h1 := fnv.New128()
-	h1.Write([]byte(key))
-	h2 := fnv.New128a()
-	h2.Write([]byte(key))
-	buf = h1.Sum(buf)
-	buf = h2.Sum(buf)
-	mod := uint64(len(t.counts))
-	h[0] = binary.BigEndian.Uint64(buf[:8]) % mod
-	h[1] = binary.BigEndian.Uint64(buf[8:16]) % mod
-	h[2] = binary.BigEndian.Uint64(buf[16:24]) % mod
-	h[3] = binary.BigEndian.Uint64(buf[24:32]) % mod
-	return h
+// Hash hashes key with the sketch's Hasher for use with the *Hash methods.
+func (t *TinyLFU32) Hash(key string) uint64 {
+	return t.hasher.Hash(key)
+}
+
+// strings returns the sketch's string API, a TinyLFU[string] over its
+// counters hashed with its Hasher.
+func (t *TinyLFU32) strings() *TinyLFU[string] {
+	return &TinyLFU[string]{counters: t, hasher: t.hasher}
+}
+
+// Decimations counts a decimation from the moment it begins.
+func (t *TinyLFU32) Decimations() uint64 {
+	return (atomic.LoadUint64(&t.epoch) + 1) / 2
 }
 
-func (t *TinyLFU32) read(hashes [4]uint64) (uint32, uint64) {
+func (t *TinyLFU32) read(key uint64) (uint32, uint64) {
+	if t.aging == AgingIncremental {
+		return t.readIncremental(key)
+	}
+	h1, h2 := bloom.Derive(key)
+	mod := uint64(len(t.counts))
 	for {
 		epoch := atomic.LoadUint64(&t.epoch)
 		count := ^uint32(0)
 		for i := uint(0); i < t.keys; i++ {
-			x := atomic.LoadUint32(&t.counts[hashes[i]])
+			x := atomic.LoadUint32(&t.counts[probe(h1, h2, i, mod)])
 			if x < count {
 				count = x
 			}
 		}
 		if epoch == atomic.LoadUint64(&t.epoch) {
-			return count, epoch
+			return credit32(count, t.door, key), epoch
+		}
+	}
+}
+
+// readIncremental reads a key's count as of the current epoch.  Counters in
+// blocks the sweep has not yet reached are halved on the fly, so the result
+// is the same as if the sweep had already finished.
+func (t *TinyLFU32) readIncremental(key uint64) (uint32, uint64) {
+	h1, h2 := bloom.Derive(key)
+	mod := uint64(len(t.counts))
+	for {
+		epoch := atomic.LoadUint64(&t.epoch)
+		count := ^uint32(0)
+		stale := false
+		for i := uint(0); i < t.keys; i++ {
+			x, done := t.readBlock(probe(h1, h2, i, mod))
+			if done > epoch {
+				// a newer sweep has passed this block
+				stale = true
+				break
+			}
+			x >>= (epoch - done) / 2
+			if x < count {
+				count = x
+			}
+		}
+		if !stale {
+			return credit32(count, t.door, key), epoch
+		}
+	}
+}
+
+// readBlock reads one counter and the epoch its block was last halved to.
+// It waits only while that one block is being halved.
+func (t *TinyLFU32) readBlock(idx uint64) (uint32, uint64) {
+	b := idx / decimationBlock
+	for {
+		epoch := atomic.LoadUint64(&t.blocks[b])
+		if epoch&0x1 == 1 {
+			continue
+		}
+		x := atomic.LoadUint32(&t.counts[idx])
+		if epoch == atomic.LoadUint64(&t.blocks[b]) {
+			return x, epoch
 		}
 	}
 }
 
 func (t *TinyLFU32) decimate() {
+	if t.aging == AgingIncremental {
+		t.decimateIncremental()
+		return
+	}
 	t.mtx.Lock()
 	defer t.mtx.Unlock()
 	atomic.AddUint64(&t.epoch, 1)
 	divideTwo(&t.counter)
+	t.clearDoorkeeper()
 	for i := 0; i < len(t.counts); i++ {
 		divideTwo(&t.counts[i])
 	}
 	atomic.AddUint64(&t.epoch, 1)
 }
 
+// decimateIncremental advances the epoch first and then halves one block at
+// a time, marking each block odd while it is in progress.
+func (t *TinyLFU32) decimateIncremental() {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	epoch := atomic.AddUint64(&t.epoch, 2)
+	divideTwo(&t.counter)
+	t.clearDoorkeeper()
+	for b := range t.blocks {
+		atomic.StoreUint64(&t.blocks[b], epoch-1)
+		end := min((b+1)*decimationBlock, len(t.counts))
+		for i := b * decimationBlock; i < end; i++ {
+			divideTwo(&t.counts[i])
+		}
+		atomic.StoreUint64(&t.blocks[b], epoch)
+	}
+}
+
+func (t *TinyLFU32) clearDoorkeeper() {
+	if t.door != nil {
+		t.door.Clear()
+	}
+}
+
+// addSaturating adds n to *p, stopping at math.MaxUint32 rather than
+// wrapping.
+func addSaturating(p *uint32, n uint64) {
+	for {
+		value := atomic.LoadUint32(p)
+		if value == math.MaxUint32 {
+			break
+		}
+		delta := uint32(min(n, uint64(math.MaxUint32-value)))
+		if atomic.CompareAndSwapUint32(p, value, value+delta) {
+			break
+		}
+	}
+}
+
+// credit32 adds the doorkeeper's unit to a count unless the count is already
+// saturated.
+func credit32(count uint32, door *bloom.Concurrent, key uint64) uint32 {
+	if count == math.MaxUint32 {
+		return count
+	}
+	return count + uint32(seen(door, key))
+}
+
 func divideTwo(p *uint32) {
 	for {
 		value := atomic.LoadUint32(p)
@@ -1,77 +1,230 @@
 package tiny_lfu
 
 import (
-	"encoding/binary"
-	"hash/fnv"
 	"math"
+	"math/bits"
+	"sync"
 	"sync/atomic"
 
 	"hack.systems/util/bloom"
 )
 
 type TinyLFU64 struct {
-	keys   uint
-	counts []uint64
-}
-
-func New64(memory uint64, space uint64) *TinyLFU64 {
-	N := float64(memory)
-	M := float64(space) / 8
-	P := bloom.BloomParamsP(N, M)
-	if P < minP {
-		P = minP
-		M = bloom.BloomParamsM(N, P)
-		if M*8 > float64(space) {
-			panic("error in bloom parameter calculations")
-		}
+	memory  uint64
+	counter uint64
+	epoch   uint64
+	aging   Aging
+	keys    uint
+	counts  []uint64
+	door    *bloom.Concurrent
+	stripes *stripes
+	hasher  Hasher
+	mtx     sync.Mutex
+}
+
+// New64 returns a sketch sized for memory tallies that uses at most space
+// bytes of 64-bit counters.  It supports AgingReset, AgingContinuous, and
+// AgingNone.  Unlike the other sketches it defaults to AgingNone and keeps
+// every tally unless WithAging says otherwise.
+func New64(memory uint64, space uint64, opts ...Option) (*TinyLFU64, error) {
+	o := makeOptions(append([]Option{WithAging(AgingNone)}, opts...))
+	if o.aging == AgingIncremental {
+		return nil, BadAging
 	}
-	K := bloom.KeysForProbability(P)
-	counts := uint64(M)
-	return &TinyLFU64{
-		keys:   uint(math.Ceil(K)),
-		counts: make([]uint64, counts),
+	counts, keys, err := size(memory, space, 64, o)
+	if err != nil {
+		return nil, err
 	}
+	return &TinyLFU64{
+		memory:  memory,
+		aging:   o.aging,
+		keys:    keys,
+		counts:  make([]uint64, counts),
+		door:    doorkeeper(memory, o),
+		stripes: newStripes(memory, o),
+		hasher:  o.hasher,
+	}, nil
 }
 
 func (t *TinyLFU64) Tally(key string) {
-	h := t.hash(key)
-	for i := uint(0); i < t.keys; i++ {
-		atomic.AddUint64(&t.counts[h[i]], 1)
+	t.strings().Tally(key)
+}
+
+func (t *TinyLFU64) TallyHash(key uint64) {
+	t.TallyNHash(key, 1)
+}
+
+func (t *TinyLFU64) TallyN(key string, n uint64) {
+	t.strings().TallyN(key, n)
+}
+
+// TallyNHash records n occurrences of key, saturating its counters.  A
+// weight above memory ages the sketch only as much as memory tallies would.
+func (t *TinyLFU64) TallyNHash(key uint64, n uint64) {
+	if n == 0 {
+		return
+	}
+	if x := admit(t.door, key, n); x > 0 {
+		h1, h2 := bloom.Derive(key)
+		mod := uint64(len(t.counts))
+		for i := uint(0); i < t.keys; i++ {
+			addSaturating64(&t.counts[probe(h1, h2, i, mod)], x)
+		}
+	}
+	if t.aging == AgingNone {
+		return
+	}
+	n = t.stripes.add(min(n, t.memory))
+	if n == 0 {
+		return
+	}
+	switch t.aging {
+	case AgingReset:
+		if crossed(atomic.AddUint64(&t.counter, n), n, t.memory) {
+			t.decimate()
+		}
+	case AgingContinuous:
+		sum := atomic.AddUint64(&t.counter, n)
+		for i := sum - n + 1; i <= sum; i++ {
+			t.decay(i)
+		}
+	}
+}
+
+func (t *TinyLFU64) Estimate(key string) uint64 {
+	return t.strings().Estimate(key)
+}
+
+func (t *TinyLFU64) EstimateHash(key uint64) uint64 {
+	for {
+		count, epoch := t.read(key)
+		if epoch&0x1 == 0 {
+			return count
+		}
 	}
 }
 
 func (t *TinyLFU64) ShouldReplace(victim, candidate string) bool {
-	hv := t.hash(victim)
-	hc := t.hash(candidate)
-	vCount := t.read(hv)
-	cCount := t.read(hc)
-	return vCount < cCount
-}
-
-func (t *TinyLFU64) hash(key string) [4]uint64 {
-	buf := make([]byte, 0, 32)
-	h := [4]uint64{}
-	h1 := fnv.New128()
-	h1.Write([]byte(key))
-	h2 := fnv.New128a()
-	h2.Write([]byte(key))
-	buf = h1.Sum(buf)
-	buf = h2.Sum(buf)
+	return t.strings().ShouldReplace(victim, candidate)
+}
+
+func (t *TinyLFU64) ShouldReplaceHash(victim, candidate uint64) bool {
+	for {
+		vCount, vEpoch := t.read(victim)
+		cCount, cEpoch := t.read(candidate)
+		if vEpoch == cEpoch {
+			if cEpoch&0x1 == 1 {
+				continue
+			}
+			return vCount < cCount
+		}
+	}
+}
+
+// Hash hashes key with the sketch's Hasher for use with the *Hash methods.
+func (t *TinyLFU64) Hash(key string) uint64 {
+	return t.hasher.Hash(key)
+}
+
+// strings returns the sketch's string API, a TinyLFU[string] over its
+// counters hashed with its Hasher.
+func (t *TinyLFU64) strings() *TinyLFU[string] {
+	return &TinyLFU[string]{counters: t, hasher: t.hasher}
+}
+
+// Decimations counts a decimation from the moment it begins or, with
+// AgingContinuous, the passes of decay over every counter, which complete
+// once per memory tallies.
+func (t *TinyLFU64) Decimations() uint64 {
+	if t.aging == AgingContinuous {
+		return atomic.LoadUint64(&t.counter) / t.memory
+	}
+	return (atomic.LoadUint64(&t.epoch) + 1) / 2
+}
+
+func (t *TinyLFU64) read(key uint64) (uint64, uint64) {
+	h1, h2 := bloom.Derive(key)
 	mod := uint64(len(t.counts))
-	h[0] = binary.BigEndian.Uint64(buf[:8]) % mod
-	h[1] = binary.BigEndian.Uint64(buf[8:16]) % mod
-	h[2] = binary.BigEndian.Uint64(buf[16:24]) % mod
-	h[3] = binary.BigEndian.Uint64(buf[24:32]) % mod
-	return h
-}
-
-func (t *TinyLFU64) read(hashes [4]uint64) uint64 {
-	count := ^uint64(0)
-	for i := uint(0); i < t.keys; i++ {
-		x := atomic.LoadUint64(&t.counts[hashes[i]])
-		if x < count {
-			count = x
+	for {
+		epoch := atomic.LoadUint64(&t.epoch)
+		count := ^uint64(0)
+		for i := uint(0); i < t.keys; i++ {
+			x := atomic.LoadUint64(&t.counts[probe(h1, h2, i, mod)])
+			if x < count {
+				count = x
+			}
+		}
+		if epoch == atomic.LoadUint64(&t.epoch) {
+			if count < math.MaxUint64 {
+				count += seen(t.door, key)
+			}
+			return count, epoch
+		}
+	}
+}
+
+func (t *TinyLFU64) decimate() {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	atomic.AddUint64(&t.epoch, 1)
+	divideTwo64(&t.counter)
+	t.clearDoorkeeper()
+	for i := 0; i < len(t.counts); i++ {
+		divideTwo64(&t.counts[i])
+	}
+	atomic.AddUint64(&t.epoch, 1)
+}
+
+// decay halves the slice of counters that the n-th tally is responsible for.
+// The slices of consecutive tallies tile the array, so every counter is
+// halved once per memory tallies, but at staggered times rather than all at
+// once, and no tally ever waits on another.
+func (t *TinyLFU64) decay(n uint64) {
+	k := (n - 1) % t.memory
+	width := uint64(len(t.counts))
+	start := mulDiv(k, width, t.memory)
+	end := mulDiv(k+1, width, t.memory)
+	for i := start; i < end; i++ {
+		divideTwo64(&t.counts[i])
+	}
+	if k+1 == t.memory {
+		t.clearDoorkeeper()
+	}
+}
+
+func (t *TinyLFU64) clearDoorkeeper() {
+	if t.door != nil {
+		t.door.Clear()
+	}
+}
+
+// mulDiv computes x*y/z without overflow, provided x <= z.
+func mulDiv(x, y, z uint64) uint64 {
+	hi, lo := bits.Mul64(x, y)
+	q, _ := bits.Div64(hi, lo, z)
+	return q
+}
+
+// addSaturating64 adds n to *p, stopping at math.MaxUint64 rather than
+// wrapping.
+func addSaturating64(p *uint64, n uint64) {
+	for {
+		value := atomic.LoadUint64(p)
+		if value == math.MaxUint64 {
+			break
+		}
+		delta := min(n, math.MaxUint64-value)
+		if atomic.CompareAndSwapUint64(p, value, value+delta) {
+			break
+		}
+	}
+}
+
+func divideTwo64(p *uint64) {
+	for {
+		value := atomic.LoadUint64(p)
+		if atomic.CompareAndSwapUint64(p, value, value/2) {
+			break
 		}
 	}
-	return count
 }
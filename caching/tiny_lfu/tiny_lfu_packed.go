@@ -0,0 +1,233 @@
+package tiny_lfu
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"hack.systems/util/bloom"
+)
+
+// TinyLFU4 is a TinyLFU sketch of 4-bit saturating counters packed sixteen
+// to a word.  Because counters are halved every memory tallies, small
+// counters lose little precision, and the same space holds eight times as
+// many of them as TinyLFU32 does, for fewer collisions.
+//
+// Construct a sketch with New4.  It supports AgingReset only.
+type TinyLFU4 struct {
+	packed
+}
+
+// TinyLFU8 is TinyLFU4 with 8-bit counters, for windows in which popular
+// keys would saturate at fifteen.
+//
+// Construct a sketch with New8.  It supports AgingReset only.
+type TinyLFU8 struct {
+	packed
+}
+
+func New4(memory uint64, space uint64, opts ...Option) (*TinyLFU4, error) {
+	t := &TinyLFU4{}
+	if err := t.init(memory, space, 4, opts); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func New8(memory uint64, space uint64, opts ...Option) (*TinyLFU8, error) {
+	t := &TinyLFU8{}
+	if err := t.init(memory, space, 8, opts); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// packed implements the sketch for any counter width that divides 64.
+// Counters are updated with a compare-and-swap on their containing word, so
+// neighbors never lose each other's increments.
+type packed struct {
+	memory  uint64
+	counter uint64
+	epoch   uint64
+	width   uint
+	keys    uint
+	slots   uint64
+	words   []uint64
+	door    *bloom.Concurrent
+	stripes *stripes
+	hasher  Hasher
+	mtx     sync.Mutex
+}
+
+func (t *packed) init(memory, space uint64, width uint, opts []Option) error {
+	o := makeOptions(opts)
+	if o.aging != AgingReset {
+		return BadAging
+	}
+	slots, keys, err := size(memory, space, uint64(width), o)
+	if err != nil {
+		return err
+	}
+	t.memory = memory
+	t.width = width
+	t.keys = keys
+	t.slots = slots
+	t.words = make([]uint64, (slots+t.perWord()-1)/t.perWord())
+	t.door = doorkeeper(memory, o)
+	t.stripes = newStripes(memory, o)
+	t.hasher = o.hasher
+	return nil
+}
+
+func (t *packed) Tally(key string) {
+	t.strings().Tally(key)
+}
+
+func (t *packed) TallyHash(key uint64) {
+	t.TallyNHash(key, 1)
+}
+
+func (t *packed) TallyN(key string, n uint64) {
+	t.strings().TallyN(key, n)
+}
+
+// TallyNHash records n occurrences of key, saturating its counters.  A
+// weight above memory ages the sketch only as much as memory tallies would.
+func (t *packed) TallyNHash(key uint64, n uint64) {
+	if n == 0 {
+		return
+	}
+	if x := admit(t.door, key, n); x > 0 {
+		h1, h2 := bloom.Derive(key)
+		for i := uint(0); i < t.keys; i++ {
+			t.add(probe(h1, h2, i, t.slots), x)
+		}
+	}
+	n = t.stripes.add(min(n, t.memory))
+	if n == 0 {
+		return
+	}
+	if crossed(atomic.AddUint64(&t.counter, n), n, t.memory) {
+		t.decimate()
+	}
+}
+
+func (t *packed) Estimate(key string) uint64 {
+	return t.strings().Estimate(key)
+}
+
+func (t *packed) EstimateHash(key uint64) uint64 {
+	for {
+		count, epoch := t.read(key)
+		if epoch&0x1 == 0 {
+			return count
+		}
+	}
+}
+
+func (t *packed) ShouldReplace(victim, candidate string) bool {
+	return t.strings().ShouldReplace(victim, candidate)
+}
+
+func (t *packed) ShouldReplaceHash(victim, candidate uint64) bool {
+	for {
+		vCount, vEpoch := t.read(victim)
+		cCount, cEpoch := t.read(candidate)
+		if vEpoch == cEpoch {
+			if cEpoch&0x1 == 1 {
+				continue
+			}
+			return vCount < cCount
+		}
+	}
+}
+
+// Hash hashes key with the sketch's Hasher for use with the *Hash methods.
+func (t *packed) Hash(key string) uint64 {
+	return t.hasher.Hash(key)
+}
+
+// strings returns the sketch's string API, a TinyLFU[string] over its
+// counters hashed with its Hasher.
+func (t *packed) strings() *TinyLFU[string] {
+	return &TinyLFU[string]{counters: t, hasher: t.hasher}
+}
+
+// Decimations counts a decimation from the moment it begins.
+func (t *packed) Decimations() uint64 {
+	return (atomic.LoadUint64(&t.epoch) + 1) / 2
+}
+
+func (t *packed) read(key uint64) (uint64, uint64) {
+	h1, h2 := bloom.Derive(key)
+	for {
+		epoch := atomic.LoadUint64(&t.epoch)
+		count := ^uint64(0)
+		for i := uint(0); i < t.keys; i++ {
+			x := t.get(probe(h1, h2, i, t.slots))
+			if x < count {
+				count = x
+			}
+		}
+		if epoch == atomic.LoadUint64(&t.epoch) {
+			return count + seen(t.door, key), epoch
+		}
+	}
+}
+
+func (t *packed) max() uint64 {
+	return 1<<t.width - 1
+}
+
+func (t *packed) perWord() uint64 {
+	return uint64(64 / t.width)
+}
+
+func (t *packed) locate(slot uint64) (*uint64, uint) {
+	per := t.perWord()
+	return &t.words[slot/per], uint(slot%per) * t.width
+}
+
+func (t *packed) get(slot uint64) uint64 {
+	w, shift := t.locate(slot)
+	return (atomic.LoadUint64(w) >> shift) & t.max()
+}
+
+func (t *packed) add(slot, n uint64) {
+	w, shift := t.locate(slot)
+	for {
+		value := atomic.LoadUint64(w)
+		x := (value >> shift) & t.max()
+		if x == t.max() {
+			break
+		}
+		delta := min(n, t.max()-x)
+		if atomic.CompareAndSwapUint64(w, value, value+delta<<shift) {
+			break
+		}
+	}
+}
+
+// decimate halves every counter in a word at once by shifting the word right
+// and clearing the bit each counter received from its neighbor.
+func (t *packed) decimate() {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	mask := ^uint64(0)
+	for i := uint(0); i < 64; i += t.width {
+		mask &^= 1 << (i + t.width - 1)
+	}
+	atomic.AddUint64(&t.epoch, 1)
+	divideTwo64(&t.counter)
+	if t.door != nil {
+		t.door.Clear()
+	}
+	for i := range t.words {
+		for {
+			value := atomic.LoadUint64(&t.words[i])
+			if atomic.CompareAndSwapUint64(&t.words[i], value, (value>>1)&mask) {
+				break
+			}
+		}
+	}
+	atomic.AddUint64(&t.epoch, 1)
+}
@@ -1,17 +1,24 @@
 package tiny_lfu_test
 
 import (
+	"bytes"
+	"fmt"
+	"math"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
+	"hack.systems/util/bloom"
 	"hack.systems/util/caching/tiny_lfu"
+	"hack.systems/util/envelope"
 )
 
 func TestTinyLFU32(t *testing.T) {
 	require := require.New(t)
 
-	c := tiny_lfu.New32(1e7, 1e8)
+	c, err := tiny_lfu.New32(1e7, 1e8)
+	require.NoError(err)
 	require.NotNil(c)
 	for i := 0; i < 10; i++ {
 		c.Tally("hello")
@@ -24,7 +31,8 @@ func TestTinyLFU32(t *testing.T) {
 func TestTinyLFU64(t *testing.T) {
 	require := require.New(t)
 
-	c := tiny_lfu.New64(1e7, 1e8)
+	c, err := tiny_lfu.New64(1e7, 1e8)
+	require.NoError(err)
 	require.NotNil(c)
 	for i := 0; i < 10; i++ {
 		c.Tally("hello")
@@ -33,3 +41,613 @@ func TestTinyLFU64(t *testing.T) {
 	require.True(c.ShouldReplace("goodbye", "hello"))
 	require.False(c.ShouldReplace("hello", "goodbye"))
 }
+
+func TestTinyLFU32Encoding(t *testing.T) {
+	require := require.New(t)
+
+	c, err := tiny_lfu.New32(1e3, 1e4)
+	require.NoError(err)
+	for i := 0; i < 10; i++ {
+		c.Tally("hello")
+	}
+	c.Tally("goodbye")
+	data, err := c.MarshalBinary()
+	require.NoError(err)
+	d := &tiny_lfu.TinyLFU32{}
+	require.NoError(d.UnmarshalBinary(data))
+	require.True(d.ShouldReplace("goodbye", "hello"))
+	require.False(d.ShouldReplace("hello", "goodbye"))
+	again, err := d.MarshalBinary()
+	require.NoError(err)
+	require.Equal(data, again)
+	require.Equal(envelope.WrongKind, (&tiny_lfu.TinyLFU64{}).UnmarshalBinary(data))
+
+	// a sketch with no memory would decimate on every tally
+	buf := &bytes.Buffer{}
+	e := envelope.NewEncoder(buf, envelope.Header{
+		Kind:   envelope.KindTinyLFU32,
+		Hash:   envelope.HashFNV1a64,
+		Keys:   4,
+		Width:  1,
+		Length: 24,
+	})
+	e.Uint64(0)
+	e.Uint32(0)
+	e.Uint32(0)
+	e.Uint32(uint32(tiny_lfu.AgingReset))
+	e.Uint32(0)
+	_, err = e.Close()
+	require.NoError(err)
+	require.Equal(envelope.BadLength, d.UnmarshalBinary(buf.Bytes()))
+}
+
+func TestTinyLFU64Encoding(t *testing.T) {
+	require := require.New(t)
+
+	c, err := tiny_lfu.New64(1e3, 1e4)
+	require.NoError(err)
+	for i := 0; i < 10; i++ {
+		c.Tally("hello")
+	}
+	c.Tally("goodbye")
+	buf := &bytes.Buffer{}
+	_, err = c.WriteTo(buf)
+	require.NoError(err)
+	d := &tiny_lfu.TinyLFU64{}
+	_, err = d.ReadFrom(buf)
+	require.NoError(err)
+	require.True(d.ShouldReplace("goodbye", "hello"))
+	require.False(d.ShouldReplace("hello", "goodbye"))
+
+	// a rejected envelope still reports the header it consumed
+	data, err := c.MarshalBinary()
+	require.NoError(err)
+	n, err := (&tiny_lfu.TinyLFU32{}).ReadFrom(bytes.NewReader(data))
+	require.Equal(envelope.WrongKind, err)
+	require.Equal(int64(envelope.HeaderSize), n)
+}
+
+func TestXXH64(t *testing.T) {
+	require := require.New(t)
+
+	var h tiny_lfu.XXH64
+	require.Equal(uint64(0xef46db3751d8e999), h.Hash(""))
+	require.Equal(uint64(0xd24ec4f1a98c6e5b), h.Hash("a"))
+	require.Equal(uint64(0x44bc2cf5ad770999), h.Hash("abc"))
+	require.Equal(uint64(0xfbcea83c8a378bf1), h.Hash("Nobody inspects the spammish repetition"))
+}
+
+func TestHashers(t *testing.T) {
+	require := require.New(t)
+
+	hashers := []tiny_lfu.Hasher{
+		tiny_lfu.FNV1a{},
+		tiny_lfu.XXH64{},
+		tiny_lfu.NewMaphash(),
+		tiny_lfu.HasherFunc(func(key string) uint64 {
+			return bloom.Hash(key) * 31
+		}),
+	}
+	for _, h := range hashers {
+		c, err := tiny_lfu.New32(1e7, 1e8, tiny_lfu.WithHasher(h))
+		require.NoError(err)
+		hello := c.Hash("hello")
+		for i := 0; i < 10; i++ {
+			c.TallyHash(hello)
+		}
+		c.Tally("goodbye")
+		require.True(c.ShouldReplace("goodbye", "hello"))
+		require.False(c.ShouldReplaceHash(hello, h.Hash("goodbye")))
+		require.Zero(testing.AllocsPerRun(100, func() {
+			c.Tally("hello")
+		}))
+	}
+	c, err := tiny_lfu.New64(1e3, 1e4)
+	require.NoError(err)
+	require.Equal(bloom.Hash("hello"), c.Hash("hello"))
+}
+
+func TestHasherEncoding(t *testing.T) {
+	require := require.New(t)
+
+	m := tiny_lfu.NewMaphash()
+	c, err := tiny_lfu.New64(1e3, 1e4, tiny_lfu.WithHasher(m))
+	require.NoError(err)
+	c.Tally("hello")
+	data, err := c.MarshalBinary()
+	require.NoError(err)
+	require.Equal(envelope.BadHash, (&tiny_lfu.TinyLFU64{}).UnmarshalBinary(data))
+	d, err := tiny_lfu.New64(1e3, 1e4, tiny_lfu.WithHasher(m))
+	require.NoError(err)
+	require.NoError(d.UnmarshalBinary(data))
+	require.True(d.ShouldReplace("goodbye", "hello"))
+	other, err := tiny_lfu.New64(1e3, 1e4, tiny_lfu.WithHasher(tiny_lfu.NewMaphash()))
+	require.NoError(err)
+	require.Equal(envelope.BadHash, other.UnmarshalBinary(data))
+
+	f := tiny_lfu.HasherFunc(func(key string) uint64 {
+		return bloom.Hash(key) * 31
+	})
+	g := tiny_lfu.HasherFunc(func(key string) uint64 {
+		return bloom.Hash(key) * 37
+	})
+	e, err := tiny_lfu.New32(1e3, 1e4, tiny_lfu.WithHasher(f))
+	require.NoError(err)
+	data, err = e.MarshalBinary()
+	require.NoError(err)
+	same, err := tiny_lfu.New32(1e3, 1e4, tiny_lfu.WithHasher(f))
+	require.NoError(err)
+	require.NoError(same.UnmarshalBinary(data))
+	different, err := tiny_lfu.New32(1e3, 1e4, tiny_lfu.WithHasher(g))
+	require.NoError(err)
+	require.Equal(envelope.BadHash, different.UnmarshalBinary(data))
+
+	c, err = tiny_lfu.New64(1e3, 1e4, tiny_lfu.WithHasher(tiny_lfu.XXH64{}))
+	require.NoError(err)
+	c.Tally("hello")
+	data, err = c.MarshalBinary()
+	require.NoError(err)
+	d = &tiny_lfu.TinyLFU64{}
+	require.NoError(d.UnmarshalBinary(data))
+	require.True(d.ShouldReplace("goodbye", "hello"))
+	require.Equal(tiny_lfu.XXH64{}.Hash("hello"), d.Hash("hello"))
+}
+
+func TestManyKeys(t *testing.T) {
+	require := require.New(t)
+
+	c, err := tiny_lfu.New32(1e3, 1e6, tiny_lfu.WithFalsePositiveFloor(1e-6))
+	require.NoError(err)
+	for i := 0; i < 10; i++ {
+		c.Tally("hello")
+	}
+	c.Tally("goodbye")
+	require.True(c.ShouldReplace("goodbye", "hello"))
+	data, err := c.MarshalBinary()
+	require.NoError(err)
+	d := &tiny_lfu.TinyLFU32{}
+	require.NoError(d.UnmarshalBinary(data))
+	require.True(d.ShouldReplace("goodbye", "hello"))
+
+	e, err := tiny_lfu.New64(1e3, 1e6, tiny_lfu.WithFalsePositiveFloor(1e-9))
+	require.NoError(err)
+	e.Tally("hello")
+	require.True(e.ShouldReplace("goodbye", "hello"))
+}
+
+func TestBadParameters(t *testing.T) {
+	require := require.New(t)
+
+	_, err := tiny_lfu.New32(0, 1e6)
+	require.Equal(tiny_lfu.BadMemory, err)
+	_, err = tiny_lfu.New32(1e3, 3)
+	require.Equal(tiny_lfu.BadSpace, err)
+	_, err = tiny_lfu.New64(1e3, 7)
+	require.Equal(tiny_lfu.BadSpace, err)
+	_, err = tiny_lfu.New64(1e3, 1e6, tiny_lfu.WithFalsePositiveFloor(0))
+	require.Equal(tiny_lfu.BadP, err)
+	_, err = tiny_lfu.New64(1e3, 1e6, tiny_lfu.WithHasher(nil))
+	require.Equal(tiny_lfu.BadHasher, err)
+	c, err := tiny_lfu.New64(1e3, 8)
+	require.NoError(err)
+	c.Tally("hello")
+	require.False(c.ShouldReplace("hello", "goodbye"))
+}
+
+func TestTinyLFU64Aging(t *testing.T) {
+	require := require.New(t)
+
+	tally := func(c *tiny_lfu.TinyLFU64, key string, n int) {
+		for i := 0; i < n; i++ {
+			c.Tally(key)
+		}
+	}
+	reset, err := tiny_lfu.New64(100, 1e6, tiny_lfu.WithAging(tiny_lfu.AgingReset))
+	require.NoError(err)
+	// TinyLFU64 keeps every tally by default
+	none, err := tiny_lfu.New64(100, 1e6)
+	require.NoError(err)
+	for _, c := range []*tiny_lfu.TinyLFU64{reset, none} {
+		tally(c, "old", 50)
+		tally(c, "new", 30)
+		for i := 0; i < 20; i++ {
+			c.Tally(fmt.Sprintf("filler-%d", i))
+		}
+		tally(c, "new", 20)
+	}
+	require.True(reset.ShouldReplace("old", "new"))
+	require.False(none.ShouldReplace("old", "new"))
+
+	continuous, err := tiny_lfu.New64(100, 1e6, tiny_lfu.WithAging(tiny_lfu.AgingContinuous))
+	require.NoError(err)
+	tally(continuous, "old", 50)
+	for i := 0; i < 1000; i++ {
+		continuous.Tally(fmt.Sprintf("filler-%d", i))
+	}
+	tally(continuous, "new", 3)
+	require.True(continuous.ShouldReplace("old", "new"))
+
+	data, err := continuous.MarshalBinary()
+	require.NoError(err)
+	d := &tiny_lfu.TinyLFU64{}
+	require.NoError(d.UnmarshalBinary(data))
+	tally(d, "old", 50)
+	for i := 0; i < 1000; i++ {
+		d.Tally(fmt.Sprintf("filler-%d", i))
+	}
+	tally(d, "new", 3)
+	require.True(d.ShouldReplace("old", "new"))
+
+	_, err = tiny_lfu.New32(100, 1e6, tiny_lfu.WithAging(tiny_lfu.AgingContinuous))
+	require.Equal(tiny_lfu.BadAging, err)
+}
+
+func TestTinyLFU32Incremental(t *testing.T) {
+	require := require.New(t)
+
+	c, err := tiny_lfu.New32(1000, 1e6, tiny_lfu.WithAging(tiny_lfu.AgingIncremental))
+	require.NoError(err)
+	for i := 0; i < 100; i++ {
+		c.Tally("hot")
+	}
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20000; i++ {
+				c.Tally("hot")
+				c.Tally(fmt.Sprintf("cold-%d-%d", g, i))
+			}
+		}(g)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			require.True(c.ShouldReplace("cold-0-0", "hot"))
+			data, err := c.MarshalBinary()
+			require.NoError(err)
+			d := &tiny_lfu.TinyLFU32{}
+			require.NoError(d.UnmarshalBinary(data))
+			for i := 0; i < 2000; i++ {
+				d.Tally(fmt.Sprintf("filler-%d", i))
+			}
+			require.True(d.ShouldReplace("cold-0-0", "hot"))
+			return
+		default:
+			require.True(c.ShouldReplace("cold-0-0", "hot"))
+		}
+	}
+}
+
+func TestDoorkeeper(t *testing.T) {
+	require := require.New(t)
+
+	c32, err := tiny_lfu.New32(100, 1e6, tiny_lfu.WithDoorkeeper(0.01))
+	require.NoError(err)
+	c64, err := tiny_lfu.New64(100, 1e6, tiny_lfu.WithDoorkeeper(0.01), tiny_lfu.WithAging(tiny_lfu.AgingReset))
+	require.NoError(err)
+	for _, c := range []interface {
+		Tally(string)
+		ShouldReplace(string, string) bool
+	}{c32, c64} {
+		c.Tally("once")
+		require.True(c.ShouldReplace("never", "once"))
+		require.False(c.ShouldReplace("once", "never"))
+		c.Tally("twice")
+		c.Tally("twice")
+		require.True(c.ShouldReplace("once", "twice"))
+		// a decimation clears the doorkeeper
+		for i := 0; i < 100; i++ {
+			c.Tally(fmt.Sprintf("filler-%d", i))
+		}
+		require.False(c.ShouldReplace("never", "once"))
+	}
+
+	_, err = tiny_lfu.New64(100, 1e6, tiny_lfu.WithDoorkeeper(1))
+	require.Equal(tiny_lfu.BadP, err)
+}
+
+func TestTinyLFUPacked(t *testing.T) {
+	require := require.New(t)
+
+	c4, err := tiny_lfu.New4(1e7, 1e8)
+	require.NoError(err)
+	c8, err := tiny_lfu.New8(1e7, 1e8)
+	require.NoError(err)
+	for _, c := range []interface {
+		Tally(string)
+		ShouldReplace(string, string) bool
+	}{c4, c8} {
+		for i := 0; i < 10; i++ {
+			c.Tally("hello")
+		}
+		c.Tally("goodbye")
+		require.True(c.ShouldReplace("goodbye", "hello"))
+		require.False(c.ShouldReplace("hello", "goodbye"))
+	}
+
+	// 4-bit counters saturate at fifteen; 8-bit counters do not
+	for i := 0; i < 30; i++ {
+		c4.Tally("hot")
+		c8.Tally("hot")
+	}
+	for i := 0; i < 20; i++ {
+		c4.Tally("warm")
+		c8.Tally("warm")
+	}
+	require.False(c4.ShouldReplace("warm", "hot"))
+	require.True(c8.ShouldReplace("warm", "hot"))
+}
+
+func TestTinyLFUPackedDecimation(t *testing.T) {
+	require := require.New(t)
+
+	c, err := tiny_lfu.New4(100, 1e4)
+	require.NoError(err)
+	for i := 0; i < 15; i++ {
+		c.Tally("hot")
+	}
+	for i := 0; i < 8; i++ {
+		c.Tally("warm")
+	}
+	require.True(c.ShouldReplace("warm", "hot"))
+	for i := 0; i < 77; i++ {
+		c.Tally(fmt.Sprintf("filler-%d", i))
+	}
+	// decimation halves hot to 7 and warm to 4, and four more make warm 8
+	for i := 0; i < 4; i++ {
+		c.Tally("warm")
+	}
+	require.True(c.ShouldReplace("hot", "warm"))
+
+	data, err := c.MarshalBinary()
+	require.NoError(err)
+	d := &tiny_lfu.TinyLFU4{}
+	require.NoError(d.UnmarshalBinary(data))
+	require.True(d.ShouldReplace("hot", "warm"))
+	require.Equal(envelope.WrongKind, (&tiny_lfu.TinyLFU8{}).UnmarshalBinary(data))
+
+	_, err = tiny_lfu.New8(100, 1e4, tiny_lfu.WithAging(tiny_lfu.AgingNone))
+	require.Equal(tiny_lfu.BadAging, err)
+}
+
+func TestEstimate(t *testing.T) {
+	require := require.New(t)
+
+	c32, err := tiny_lfu.New32(1000, 1e6, tiny_lfu.WithDoorkeeper(0.01))
+	require.NoError(err)
+	c64, err := tiny_lfu.New64(1000, 1e6, tiny_lfu.WithAging(tiny_lfu.AgingContinuous))
+	require.NoError(err)
+	c4, err := tiny_lfu.New4(1000, 1e6)
+	require.NoError(err)
+	c8, err := tiny_lfu.New8(1000, 1e6)
+	require.NoError(err)
+	for _, c := range []tiny_lfu.Sketch{c32, c64, c4, c8} {
+		require.Zero(c.Estimate("never"))
+		c.Tally("once")
+		require.Equal(uint64(1), c.Estimate("once"))
+		c.TallyN("weighted", 10)
+		require.Equal(uint64(10), c.Estimate("weighted"))
+		c.TallyN("weighted", 0)
+		require.Equal(uint64(10), c.Estimate("weighted"))
+		require.True(c.ShouldReplace("once", "weighted"))
+	}
+	// packed counters saturate
+	c4.TallyN("weighted", 100)
+	require.Equal(uint64(15), c4.Estimate("weighted"))
+	wide, err := tiny_lfu.New32(math.MaxUint32, 1e4)
+	require.NoError(err)
+	wide.TallyN("weighted", 3<<30)
+	wide.TallyN("weighted", 3<<30)
+	require.Equal(uint64(math.MaxUint32), wide.Estimate("weighted"))
+	wide64, err := tiny_lfu.New64(100, 1e4)
+	require.NoError(err)
+	wide64.TallyN("weighted", math.MaxUint64)
+	wide64.TallyN("weighted", 5)
+	require.Equal(uint64(math.MaxUint64), wide64.Estimate("weighted"))
+	// the doorkeeper's unit does not carry a saturated count past the top
+	door64, err := tiny_lfu.New64(100, 1e4, tiny_lfu.WithDoorkeeper(0.01))
+	require.NoError(err)
+	door64.TallyN("weighted", math.MaxUint64)
+	require.Equal(uint64(math.MaxUint64), door64.Estimate("weighted"))
+	door64.TallyN("weighted", 5)
+	require.Equal(uint64(math.MaxUint64), door64.Estimate("weighted"))
+
+	// a weighted tally that reaches memory decimates once, which also
+	// forgets the unit each key left in the doorkeeper
+	c32.TallyN("heavy", 2000)
+	require.Equal(uint64(999), c32.Estimate("heavy"))
+	require.Equal(uint64(4), c32.Estimate("weighted"))
+}
+
+func TestDecimations(t *testing.T) {
+	require := require.New(t)
+
+	c32, err := tiny_lfu.New32(100, 1e4)
+	require.NoError(err)
+	c32i, err := tiny_lfu.New32(100, 1e4, tiny_lfu.WithAging(tiny_lfu.AgingIncremental))
+	require.NoError(err)
+	c64, err := tiny_lfu.New64(100, 1e4, tiny_lfu.WithAging(tiny_lfu.AgingReset))
+	require.NoError(err)
+	c64c, err := tiny_lfu.New64(100, 1e4, tiny_lfu.WithAging(tiny_lfu.AgingContinuous))
+	require.NoError(err)
+	c64n, err := tiny_lfu.New64(100, 1e4)
+	require.NoError(err)
+	c4, err := tiny_lfu.New4(100, 1e4)
+	require.NoError(err)
+	tally := func(c tiny_lfu.Sketch) {
+		require.Zero(c.Decimations())
+		for i := 0; i < 250; i++ {
+			c.Tally(fmt.Sprintf("key%d", i))
+		}
+	}
+	// decimation halves the sample counter too, so decimations after the
+	// first come every memory/2 tallies: at 100, 150, 200, and 250
+	for _, c := range []tiny_lfu.Sketch{c32, c32i, c64, c4} {
+		tally(c)
+		require.Equal(uint64(4), c.Decimations())
+	}
+	// continuous aging completes a pass every memory tallies
+	tally(c64c)
+	require.Equal(uint64(2), c64c.Decimations())
+	tally(c64n)
+	require.Zero(c64n.Decimations())
+}
+
+func TestTopK(t *testing.T) {
+	require := require.New(t)
+
+	c, err := tiny_lfu.New64(1e5, 1e6)
+	require.NoError(err)
+	top := tiny_lfu.NewTopK(c, 3)
+	for i := 0; i < 100; i++ {
+		top.Tally(fmt.Sprintf("cold-%d", i))
+	}
+	top.TallyN("a", 50)
+	top.TallyN("b", 40)
+	top.TallyN("c", 30)
+	top.TallyN("d", 5)
+	require.Equal([]tiny_lfu.Hitter{
+		{Key: "a", Count: 50},
+		{Key: "b", Count: 40},
+		{Key: "c", Count: 30},
+	}, top.Top())
+	top.TallyN("d", 30)
+	require.Equal([]tiny_lfu.Hitter{
+		{Key: "a", Count: 50},
+		{Key: "b", Count: 40},
+		{Key: "d", Count: 35},
+	}, top.Top())
+
+	require.Panics(func() { tiny_lfu.NewTopK(c, 0) })
+}
+
+func TestNewTinyLFU(t *testing.T) {
+	require := require.New(t)
+
+	c, err := tiny_lfu.New32(1e5, 1e6)
+	require.NoError(err)
+
+	ints := tiny_lfu.NewTinyLFU(c, tiny_lfu.HashInteger[int])
+	ints.TallyN(42, 3)
+	ints.Tally(7)
+	require.Equal(uint64(3), ints.Estimate(42))
+	require.True(ints.ShouldReplace(7, 42))
+	require.False(ints.ShouldReplace(42, 7))
+
+	type point struct{ x, y int }
+	points := tiny_lfu.NewTinyLFU[point](c, nil)
+	points.TallyN(point{1, 2}, 2)
+	require.Equal(uint64(2), points.Estimate(point{1, 2}))
+	require.True(points.ShouldReplace(point{2, 1}, point{1, 2}))
+
+	// string keys agree with the sketch's own API by default
+	strs := tiny_lfu.NewTinyLFU[string](c, nil)
+	strs.TallyN("hello", 5)
+	require.Equal(uint64(5), c.Estimate("hello"))
+	require.Equal(c.Hash("hello"), strs.Hash("hello"))
+
+	// so do named string types, in every process
+	type id string
+	ids := tiny_lfu.NewTinyLFU[id](c, nil)
+	ids.Tally("hello")
+	require.Equal(uint64(6), c.Estimate("hello"))
+	require.Equal(c.Hash("hello"), ids.Hash("hello"))
+	require.Equal(tiny_lfu.Counters(c), ids.Counters())
+}
+
+func TestStripes(t *testing.T) {
+	require := require.New(t)
+
+	// batches of 25 tallies, so decimation is at most 100 tallies late
+	c, err := tiny_lfu.New32(6400, 1e6, tiny_lfu.WithStripes(4))
+	require.NoError(err)
+	c.TallyN("hot", 10)
+	for i := 0; i < 6300; i++ {
+		c.Tally(fmt.Sprintf("filler-%d", i))
+	}
+	require.Equal(uint64(10), c.Estimate("hot"))
+	for i := 0; i < 200; i++ {
+		c.Tally(fmt.Sprintf("filler-%d", i))
+	}
+	require.Equal(uint64(5), c.Estimate("hot"))
+
+	_, err = tiny_lfu.New64(100, 1e6, tiny_lfu.WithStripes(-1))
+	require.Equal(tiny_lfu.BadStripes, err)
+}
+
+func TestBuffer(t *testing.T) {
+	require := require.New(t)
+
+	c, err := tiny_lfu.New64(1e6, 1e7)
+	require.NoError(err)
+	b := tiny_lfu.NewBuffer(c, 4, 16)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				b.Tally("hot")
+			}
+		}()
+	}
+	wg.Wait()
+	b.Flush()
+	require.Equal(uint64(800), c.Estimate("hot"))
+
+	require.Panics(func() { tiny_lfu.NewBuffer(c, 0, 16) })
+}
+
+type tallier interface {
+	TallyHash(uint64)
+}
+
+// benchmarkTally runs parallelism goroutines per GOMAXPROCS.
+func benchmarkTally(b *testing.B, parallelism int, t tallier) {
+	hashes := make([]uint64, 1<<16)
+	for i := range hashes {
+		hashes[i] = bloom.Hash(fmt.Sprintf("key-%d", i))
+	}
+	b.SetParallelism(parallelism)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			t.TallyHash(hashes[i&(len(hashes)-1)])
+		}
+	})
+}
+
+func newTally32(opts ...tiny_lfu.Option) tallier {
+	c, err := tiny_lfu.New32(1e6, 1e7, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func newBuffered32() tallier {
+	return tiny_lfu.NewBuffer(newTally32().(tiny_lfu.Sketch), 64, 256)
+}
+
+func BenchmarkTally32SharedP1(b *testing.B)   { benchmarkTally(b, 1, newTally32()) }
+func BenchmarkTally32SharedP16(b *testing.B)  { benchmarkTally(b, 16, newTally32()) }
+func BenchmarkTally32SharedP256(b *testing.B) { benchmarkTally(b, 256, newTally32()) }
+func BenchmarkTally32StripedP1(b *testing.B) {
+	benchmarkTally(b, 1, newTally32(tiny_lfu.WithStripes(64)))
+}
+func BenchmarkTally32StripedP16(b *testing.B) {
+	benchmarkTally(b, 16, newTally32(tiny_lfu.WithStripes(64)))
+}
+func BenchmarkTally32StripedP256(b *testing.B) {
+	benchmarkTally(b, 256, newTally32(tiny_lfu.WithStripes(64)))
+}
+func BenchmarkTally32BufferedP1(b *testing.B)   { benchmarkTally(b, 1, newBuffered32()) }
+func BenchmarkTally32BufferedP16(b *testing.B)  { benchmarkTally(b, 16, newBuffered32()) }
+func BenchmarkTally32BufferedP256(b *testing.B) { benchmarkTally(b, 256, newBuffered32()) }
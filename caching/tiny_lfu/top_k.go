@@ -0,0 +1,138 @@
+package tiny_lfu
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+)
+
+// Hitter is a key and its estimated frequency.
+type Hitter struct {
+	Key   string
+	Count uint64
+}
+
+// TopK tracks the k keys with the highest estimates in a sketch.  Every
+// tally through TopK re-estimates the key and offers it to a min-heap of
+// the current heavy hitters.
+//
+// Estimates held in the heap go stale as the sketch ages, so the heap's
+// minimum is refreshed before any newcomer is compared against it, and Top
+// refreshes every entry.
+type TopK struct {
+	sketch Sketch
+	k      int
+	mtx    sync.Mutex
+	heap   hitterHeap
+	index  map[string]int
+}
+
+// NewTopK tracks the top k keys tallied through sketch.  It panics if k is
+// not positive.
+func NewTopK(sketch Sketch, k int) *TopK {
+	if k <= 0 {
+		panic("tiny_lfu: k must be positive")
+	}
+	t := &TopK{
+		sketch: sketch,
+		k:      k,
+		index:  make(map[string]int, k),
+	}
+	t.heap.index = t.index
+	return t
+}
+
+func (t *TopK) Tally(key string) {
+	t.TallyN(key, 1)
+}
+
+// TallyN tallies key n times in the sketch and offers it to the top k.
+func (t *TopK) TallyN(key string, n uint64) {
+	h := t.sketch.Hash(key)
+	t.sketch.TallyNHash(h, n)
+	count := t.sketch.EstimateHash(h)
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if i, ok := t.index[key]; ok {
+		t.heap.hitters[i].Count = count
+		heap.Fix(&t.heap, i)
+		return
+	}
+	if t.heap.Len() < t.k {
+		heap.Push(&t.heap, Hitter{Key: key, Count: count})
+		return
+	}
+	t.refreshMin()
+	if t.heap.hitters[0].Count < count {
+		delete(t.index, t.heap.hitters[0].Key)
+		t.heap.hitters[0] = Hitter{Key: key, Count: count}
+		t.index[key] = 0
+		heap.Fix(&t.heap, 0)
+	}
+}
+
+// Top returns the heavy hitters, most frequent first.
+func (t *TopK) Top() []Hitter {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for i := range t.heap.hitters {
+		t.heap.hitters[i].Count = t.sketch.Estimate(t.heap.hitters[i].Key)
+	}
+	heap.Init(&t.heap)
+	top := append([]Hitter(nil), t.heap.hitters...)
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Key < top[j].Key
+	})
+	return top
+}
+
+// refreshMin re-estimates the heap's minimum until it is current.  Aging
+// only lowers estimates, so each pass either settles or moves a stale entry
+// down, and at most k passes are needed.
+func (t *TopK) refreshMin() {
+	for i := 0; i < t.k; i++ {
+		count := t.sketch.Estimate(t.heap.hitters[0].Key)
+		if count == t.heap.hitters[0].Count {
+			return
+		}
+		t.heap.hitters[0].Count = count
+		heap.Fix(&t.heap, 0)
+	}
+}
+
+// hitterHeap is a min-heap of hitters by count that keeps index current.
+type hitterHeap struct {
+	hitters []Hitter
+	index   map[string]int
+}
+
+func (h *hitterHeap) Len() int {
+	return len(h.hitters)
+}
+
+func (h *hitterHeap) Less(i, j int) bool {
+	return h.hitters[i].Count < h.hitters[j].Count
+}
+
+func (h *hitterHeap) Swap(i, j int) {
+	h.hitters[i], h.hitters[j] = h.hitters[j], h.hitters[i]
+	h.index[h.hitters[i].Key] = i
+	h.index[h.hitters[j].Key] = j
+}
+
+func (h *hitterHeap) Push(x interface{}) {
+	hitter := x.(Hitter)
+	h.index[hitter.Key] = len(h.hitters)
+	h.hitters = append(h.hitters, hitter)
+}
+
+func (h *hitterHeap) Pop() interface{} {
+	n := len(h.hitters) - 1
+	hitter := h.hitters[n]
+	h.hitters = h.hitters[:n]
+	delete(h.index, hitter.Key)
+	return hitter
+}
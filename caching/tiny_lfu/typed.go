@@ -0,0 +1,112 @@
+package tiny_lfu
+
+import (
+	"hash/maphash"
+	"reflect"
+	"unsafe"
+)
+
+// TinyLFU is a sketch for keys of any comparable type, so integer and struct
+// keys need not be formatted into strings.  Keys are reduced to 64-bit
+// hashes by a hashing strategy and tallied in Counters, which hold and age
+// the counts.  The string methods of TinyLFU32, TinyLFU64, TinyLFU4, and
+// TinyLFU8 are a thin wrapper over a TinyLFU[string] whose strategy is the
+// sketch's Hasher.
+type TinyLFU[K comparable] struct {
+	counters Counters
+	hasher   keyHasher[K]
+}
+
+// NewTinyLFU puts keys of type K hashed by hash in front of counters.  When
+// hash is nil, keys of string kind, named string types included, are hashed
+// with the counters' Hasher, so that they agree with the string API and
+// encoded sketches stay meaningful.  Other keys are hashed with
+// hash/maphash, whose seed differs from process to process.
+func NewTinyLFU[K comparable](counters Counters, hash func(K) uint64) *TinyLFU[K] {
+	t := &TinyLFU[K]{counters: counters}
+	switch {
+	case hash != nil:
+		t.hasher = hashFunc[K](hash)
+	case reflect.TypeFor[K]().Kind() == reflect.String:
+		t.hasher = stringKind[K]{counters: counters}
+	default:
+		t.hasher = comparableKey[K]{seed: maphash.MakeSeed()}
+	}
+	return t
+}
+
+func (t *TinyLFU[K]) Tally(key K) {
+	t.counters.TallyHash(t.hasher.Hash(key))
+}
+
+func (t *TinyLFU[K]) TallyN(key K, n uint64) {
+	t.counters.TallyNHash(t.hasher.Hash(key), n)
+}
+
+func (t *TinyLFU[K]) Estimate(key K) uint64 {
+	return t.counters.EstimateHash(t.hasher.Hash(key))
+}
+
+func (t *TinyLFU[K]) ShouldReplace(victim, candidate K) bool {
+	return t.counters.ShouldReplaceHash(t.hasher.Hash(victim), t.hasher.Hash(candidate))
+}
+
+// Hash hashes key as the typed methods do, for use with the counters' *Hash
+// methods.
+func (t *TinyLFU[K]) Hash(key K) uint64 {
+	return t.hasher.Hash(key)
+}
+
+// Counters returns the counters the keys are tallied in.
+func (t *TinyLFU[K]) Counters() Counters {
+	return t.counters
+}
+
+// keyHasher is a strategy for hashing keys of type K.  Every Hasher is a
+// keyHasher[string].
+type keyHasher[K any] interface {
+	Hash(key K) uint64
+}
+
+type hashFunc[K any] func(K) uint64
+
+func (f hashFunc[K]) Hash(key K) uint64 {
+	return f(key)
+}
+
+// stringKind hashes keys whose underlying type is string with the counters'
+// Hasher.
+type stringKind[K comparable] struct {
+	counters Counters
+}
+
+func (s stringKind[K]) Hash(key K) uint64 {
+	return s.counters.Hash(*(*string)(unsafe.Pointer(&key)))
+}
+
+type comparableKey[K comparable] struct {
+	seed maphash.Seed
+}
+
+func (c comparableKey[K]) Hash(key K) uint64 {
+	return maphash.Comparable(c.seed, key)
+}
+
+// Integer is the set of integer types HashInteger accepts.
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// HashInteger hashes an integer key with the SplitMix64 finalizer.  Unlike
+// the maphash default it is the same in every process, so it suits sketches
+// that are encoded and restored.
+func HashInteger[K Integer](key K) uint64 {
+	h := uint64(key)
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
@@ -0,0 +1,287 @@
+// Package envelope frames the serialized state of the probabilistic
+// structures in this repository.
+//
+// Every envelope is a fixed header, a payload of little-endian words, and a
+// trailing CRC-32C over header and payload:
+//
+//	magic   [4]byte  "HSUE"
+//	version uint8
+//	kind    uint8    which structure the payload describes
+//	hash    uint8    hash scheme used to place keys
+//	_       uint8    reserved, zero
+//	keys    uint32   probes per key (K)
+//	width   uint64   slots in the structure (M)
+//	epoch   uint64
+//	length  uint64   payload bytes
+//	_       [4]byte  reserved, zero
+//	payload [length]byte
+//	crc     uint32
+package envelope
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	Version    = 1
+	HeaderSize = 40
+	// MaxLength bounds the payload of an envelope, well above that of any
+	// structure this repository builds in practice.
+	MaxLength = 1 << 32
+)
+
+// chunkWords is the most words Uint32s and Uint64s allocate before reading.
+const chunkWords = 1 << 12
+
+const (
+	KindBloom uint8 = iota + 1
+	KindTinyLFU32
+	KindTinyLFU64
+	KindTinyLFU4
+	KindTinyLFU8
+)
+
+const (
+	// HashFNV1a64 is a single 64-bit FNV-1a hash expanded to K probes by
+	// Kirsch-Mitzenmacher double hashing.
+	HashFNV1a64 uint8 = iota + 1
+	// hashReserved is never written or accepted.  It holds its place so
+	// that the schemes after it keep their values.
+	hashReserved
+	// HashXXH64 is xxHash64 with a zero seed, expanded as HashFNV1a64.
+	HashXXH64
+	// HashMaphash is hash/maphash with a per-process seed.  It is not
+	// portable across processes.
+	HashMaphash
+	// HashCustom is a caller-supplied hash that the decoder must provide.
+	HashCustom
+)
+
+var (
+	BadMagic    = errors.New("envelope: bad magic")
+	BadVersion  = errors.New("envelope: unsupported version")
+	BadChecksum = errors.New("envelope: checksum mismatch")
+	BadLength   = errors.New("envelope: payload length mismatch")
+	BadHash     = errors.New("envelope: unsupported hash scheme")
+	BadHeader   = errors.New("envelope: reserved header bytes are set")
+	WrongKind   = errors.New("envelope: wrong kind")
+)
+
+var (
+	magic  = [4]byte{'H', 'S', 'U', 'E'}
+	castag = crc32.MakeTable(crc32.Castagnoli)
+)
+
+type Header struct {
+	Kind   uint8
+	Hash   uint8
+	Keys   uint32
+	Width  uint64
+	Epoch  uint64
+	Length uint64
+}
+
+// Encoder writes one envelope.  Errors are sticky and reported by Close.
+type Encoder struct {
+	w   *bufio.Writer
+	crc hash.Hash32
+	n   int64
+	buf [8]byte
+	err error
+}
+
+func NewEncoder(w io.Writer, h Header) *Encoder {
+	e := &Encoder{
+		w:   bufio.NewWriter(w),
+		crc: crc32.New(castag),
+	}
+	var hdr [HeaderSize]byte
+	copy(hdr[0:4], magic[:])
+	hdr[4] = Version
+	hdr[5] = h.Kind
+	hdr[6] = h.Hash
+	binary.LittleEndian.PutUint32(hdr[8:12], h.Keys)
+	binary.LittleEndian.PutUint64(hdr[12:20], h.Width)
+	binary.LittleEndian.PutUint64(hdr[20:28], h.Epoch)
+	binary.LittleEndian.PutUint64(hdr[28:36], h.Length)
+	// hdr[36:40] is reserved
+	if h.Length > MaxLength {
+		e.err = BadLength
+	}
+	e.write(hdr[:])
+	return e
+}
+
+func (e *Encoder) Uint32(x uint32) {
+	binary.LittleEndian.PutUint32(e.buf[:4], x)
+	e.write(e.buf[:4])
+}
+
+func (e *Encoder) Uint64(x uint64) {
+	binary.LittleEndian.PutUint64(e.buf[:8], x)
+	e.write(e.buf[:8])
+}
+
+// Close writes the checksum and flushes.  It does not close the underlying
+// writer.  It returns the total bytes written.
+func (e *Encoder) Close() (int64, error) {
+	binary.LittleEndian.PutUint32(e.buf[:4], e.crc.Sum32())
+	e.write(e.buf[:4])
+	if e.err == nil {
+		e.err = e.w.Flush()
+	}
+	return e.n, e.err
+}
+
+func (e *Encoder) write(b []byte) {
+	if e.err != nil {
+		return
+	}
+	e.crc.Write(b)
+	n, err := e.w.Write(b)
+	e.n += int64(n)
+	e.err = err
+}
+
+// Decoder reads one envelope.  Errors are sticky and reported by Close.
+type Decoder struct {
+	r      io.Reader
+	crc    hash.Hash32
+	n      int64
+	remain uint64
+	buf    [8]byte
+	err    error
+}
+
+// NewDecoder reads and validates the header of the next envelope in r.  It
+// consumes exactly the bytes of the envelope and no more, so several
+// envelopes may be read back to back from one stream.  The Decoder is
+// returned even with an error, so that Fail can report the bytes consumed.
+func NewDecoder(r io.Reader) (*Decoder, Header, error) {
+	d := &Decoder{
+		r:   r,
+		crc: crc32.New(castag),
+	}
+	var hdr [HeaderSize]byte
+	d.read(hdr[:])
+	if d.err != nil {
+		return d, Header{}, d.err
+	}
+	if [4]byte{hdr[0], hdr[1], hdr[2], hdr[3]} != magic {
+		return d, Header{}, BadMagic
+	}
+	if hdr[4] != Version {
+		return d, Header{}, BadVersion
+	}
+	if hdr[7] != 0 || [4]byte{hdr[36], hdr[37], hdr[38], hdr[39]} != [4]byte{} {
+		return d, Header{}, BadHeader
+	}
+	h := Header{
+		Kind:   hdr[5],
+		Hash:   hdr[6],
+		Keys:   binary.LittleEndian.Uint32(hdr[8:12]),
+		Width:  binary.LittleEndian.Uint64(hdr[12:20]),
+		Epoch:  binary.LittleEndian.Uint64(hdr[20:28]),
+		Length: binary.LittleEndian.Uint64(hdr[28:36]),
+	}
+	if h.Length > MaxLength {
+		return d, Header{}, BadLength
+	}
+	d.remain = h.Length
+	return d, h, nil
+}
+
+func (d *Decoder) Uint32() uint32 {
+	d.payload(4)
+	return binary.LittleEndian.Uint32(d.buf[:4])
+}
+
+func (d *Decoder) Uint64() uint64 {
+	d.payload(8)
+	return binary.LittleEndian.Uint64(d.buf[:8])
+}
+
+// Uint32s reads n words of payload.  The slice grows as words arrive rather
+// than up front, so a corrupt header costs no more memory than the stream
+// actually holds.
+func (d *Decoder) Uint32s(n uint64) []uint32 {
+	if d.err == nil && n > d.remain/4 {
+		d.err = BadLength
+	}
+	if d.err != nil {
+		return nil
+	}
+	words := make([]uint32, 0, min(n, chunkWords))
+	for uint64(len(words)) < n && d.err == nil {
+		words = append(words, d.Uint32())
+	}
+	return words
+}
+
+// Uint64s reads n words of payload as Uint32s does.
+func (d *Decoder) Uint64s(n uint64) []uint64 {
+	if d.err == nil && n > d.remain/8 {
+		d.err = BadLength
+	}
+	if d.err != nil {
+		return nil
+	}
+	words := make([]uint64, 0, min(n, chunkWords))
+	for uint64(len(words)) < n && d.err == nil {
+		words = append(words, d.Uint64())
+	}
+	return words
+}
+
+// Close verifies that the payload was consumed exactly and that the checksum
+// matches.  It returns the total bytes read.
+func (d *Decoder) Close() (int64, error) {
+	if d.err == nil && d.remain != 0 {
+		d.err = BadLength
+	}
+	sum := d.crc.Sum32()
+	d.read(d.buf[:4])
+	if d.err == nil && binary.LittleEndian.Uint32(d.buf[:4]) != sum {
+		d.err = BadChecksum
+	}
+	return d.n, d.err
+}
+
+// Fail abandons the envelope with err, for callers whose own validation
+// rejects it.  It returns the bytes read so far and err, as ReadFrom must.
+func (d *Decoder) Fail(err error) (int64, error) {
+	d.err = err
+	return d.n, err
+}
+
+func (d *Decoder) payload(sz uint64) {
+	if d.err == nil && d.remain < sz {
+		d.err = BadLength
+	}
+	if d.err != nil {
+		for i := range d.buf {
+			d.buf[i] = 0
+		}
+		return
+	}
+	d.remain -= sz
+	d.read(d.buf[:sz])
+}
+
+func (d *Decoder) read(b []byte) {
+	if d.err != nil {
+		return
+	}
+	n, err := io.ReadFull(d.r, b)
+	d.n += int64(n)
+	if err == io.EOF && d.n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	d.err = err
+	d.crc.Write(b[:n])
+}
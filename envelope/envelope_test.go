@@ -0,0 +1,122 @@
+package envelope_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"hack.systems/util/envelope"
+)
+
+func encode(h envelope.Header, words ...uint64) []byte {
+	buf := &bytes.Buffer{}
+	e := envelope.NewEncoder(buf, h)
+	for _, w := range words {
+		e.Uint64(w)
+	}
+	if _, err := e.Close(); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	h := envelope.Header{
+		Kind:   envelope.KindBloom,
+		Hash:   envelope.HashFNV1a64,
+		Keys:   7,
+		Width:  128,
+		Epoch:  42,
+		Length: 16,
+	}
+	data := encode(h, 0xdeadbeef, 0xcafebabe)
+	require.Len(data, envelope.HeaderSize+16+4)
+	d, got, err := envelope.NewDecoder(bytes.NewReader(data))
+	require.NoError(err)
+	require.Equal(h, got)
+	require.Equal(uint64(0xdeadbeef), d.Uint64())
+	require.Equal(uint64(0xcafebabe), d.Uint64())
+	n, err := d.Close()
+	require.NoError(err)
+	require.Equal(int64(len(data)), n)
+}
+
+func TestCorruption(t *testing.T) {
+	require := require.New(t)
+
+	h := envelope.Header{Kind: envelope.KindBloom, Length: 8}
+	data := encode(h, 1)
+
+	flipped := append([]byte{}, data...)
+	flipped[envelope.HeaderSize] ^= 0x1
+	d, _, err := envelope.NewDecoder(bytes.NewReader(flipped))
+	require.NoError(err)
+	d.Uint64()
+	_, err = d.Close()
+	require.Equal(envelope.BadChecksum, err)
+
+	d, _, err = envelope.NewDecoder(bytes.NewReader(data))
+	require.NoError(err)
+	d.Uint64()
+	d.Uint64()
+	_, err = d.Close()
+	require.Equal(envelope.BadLength, err)
+
+	_, _, err = envelope.NewDecoder(bytes.NewReader(data[1:]))
+	require.Equal(envelope.BadMagic, err)
+
+	versioned := append([]byte{}, data...)
+	versioned[4] = envelope.Version + 1
+	d, _, err = envelope.NewDecoder(bytes.NewReader(versioned))
+	require.Equal(envelope.BadVersion, err)
+	n, err := d.Fail(err)
+	require.Equal(int64(envelope.HeaderSize), n)
+	require.Equal(envelope.BadVersion, err)
+
+	// a caller rejecting the header reports the bytes it consumed
+	d, _, err = envelope.NewDecoder(bytes.NewReader(data))
+	require.NoError(err)
+	n, err = d.Fail(envelope.WrongKind)
+	require.Equal(int64(envelope.HeaderSize), n)
+	require.Equal(envelope.WrongKind, err)
+}
+
+func TestReserved(t *testing.T) {
+	require := require.New(t)
+
+	data := encode(envelope.Header{Kind: envelope.KindBloom, Length: 8}, 1)
+	for _, i := range []int{7, 36, 39} {
+		reserved := append([]byte{}, data...)
+		reserved[i] = 0x1
+		_, _, err := envelope.NewDecoder(bytes.NewReader(reserved))
+		require.Equal(envelope.BadHeader, err)
+	}
+}
+
+func TestLength(t *testing.T) {
+	require := require.New(t)
+
+	buf := &bytes.Buffer{}
+	e := envelope.NewEncoder(buf, envelope.Header{Length: envelope.MaxLength + 1})
+	_, err := e.Close()
+	require.Equal(envelope.BadLength, err)
+
+	// a header may claim far more words than the stream holds
+	h := envelope.Header{Kind: envelope.KindBloom, Length: envelope.MaxLength}
+	data := encode(h, 1, 2)
+	d, _, err := envelope.NewDecoder(bytes.NewReader(data))
+	require.NoError(err)
+	words := d.Uint64s(envelope.MaxLength / 8)
+	require.Equal([]uint64{1, 2}, words[:2])
+	_, err = d.Close()
+	require.Error(err)
+
+	d, _, err = envelope.NewDecoder(bytes.NewReader(data))
+	require.NoError(err)
+	require.Nil(d.Uint64s(envelope.MaxLength/8 + 1))
+	_, err = d.Close()
+	require.Equal(envelope.BadLength, err)
+}
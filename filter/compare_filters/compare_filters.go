@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"hack.systems/util/bloom"
+	"hack.systems/util/filter"
+	"hack.systems/util/ubench"
+)
+
+type parameters struct {
+	Keys          uint64  `number of keys to insert into each filter`
+	Probes        uint64  `number of absent keys to probe for false positives`
+	FalsePositive float64 `target false-positive probability`
+	Filter        string
+}
+
+type result struct {
+	BitsPerKey        float64 `table bits divided by keys inserted`
+	FalsePositiveRate float64 `fraction of absent keys reported present`
+	Rejected          uint64  `keys the filter refused to insert`
+	InsertNanos       float64 `average nanoseconds per insert`
+	LookupNanos       float64 `average nanoseconds per lookup`
+}
+
+type builder func(params parameters, keys []string) (filter.Filter, uint64)
+
+var builders = []struct {
+	name  string
+	build builder
+}{
+	{"Bloom", func(params parameters, keys []string) (filter.Filter, uint64) {
+		f := bloom.New(params.Keys, params.FalsePositive)
+		for _, k := range keys {
+			f.Add(k)
+		}
+		return f, 0
+	}},
+	{"Blocked", func(params parameters, keys []string) (filter.Filter, uint64) {
+		f := bloom.NewBlocked(params.Keys, params.FalsePositive)
+		for _, k := range keys {
+			f.Add(k)
+		}
+		return f, 0
+	}},
+	{"Concurrent", func(params parameters, keys []string) (filter.Filter, uint64) {
+		f := bloom.NewConcurrent(params.Keys, params.FalsePositive)
+		for _, k := range keys {
+			f.Add(k)
+		}
+		return f, 0
+	}},
+	{"Counting4", func(params parameters, keys []string) (filter.Filter, uint64) {
+		f := bloom.NewCounting(params.Keys, params.FalsePositive, 4)
+		for _, k := range keys {
+			f.Add(k)
+		}
+		return f, 0
+	}},
+	{"Scalable", func(params parameters, keys []string) (filter.Filter, uint64) {
+		f := bloom.NewScalable(params.Keys/16, params.FalsePositive, bloom.DefaultGrowth, bloom.DefaultTightening)
+		for _, k := range keys {
+			f.Add(k)
+		}
+		return f, 0
+	}},
+	{"Cuckoo", func(params parameters, keys []string) (filter.Filter, uint64) {
+		f := filter.NewCuckoo(params.Keys, params.FalsePositive)
+		rejected := uint64(0)
+		for _, k := range keys {
+			if !f.Add(k) {
+				rejected++
+			}
+		}
+		return f, rejected
+	}},
+	{"Xor", func(params parameters, keys []string) (filter.Filter, uint64) {
+		return filter.NewXor(keys), 0
+	}},
+}
+
+func measure(params parameters, build builder) result {
+	keys := make([]string, params.Keys)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	probes := make([]string, params.Probes)
+	for i := range probes {
+		probes[i] = fmt.Sprintf("absent-%d", i)
+	}
+	start := time.Now()
+	f, rejected := build(params, keys)
+	insert := time.Since(start)
+	positives := uint64(0)
+	start = time.Now()
+	for _, p := range probes {
+		if f.MayContain(p) {
+			positives++
+		}
+	}
+	lookup := time.Since(start)
+	return result{
+		BitsPerKey:        float64(f.Bits()) / float64(params.Keys),
+		FalsePositiveRate: float64(positives) / float64(params.Probes),
+		Rejected:          rejected,
+		InsertNanos:       float64(insert.Nanoseconds()) / float64(params.Keys),
+		LookupNanos:       float64(lookup.Nanoseconds()) / float64(params.Probes),
+	}
+}
+
+func main() {
+	params := parameters{
+		Keys:          1e6,
+		Probes:        1e6,
+		FalsePositive: 0.01,
+	}
+	var results result
+
+	// setup
+	ubench.AddFlags(&params)
+	flag.Parse()
+	if params.Keys == 0 || params.Probes == 0 {
+		panic("need at least one key and one probe to measure")
+	}
+	ubench.PrintCommentString(params, results)
+	for _, b := range builders {
+		params.Filter = b.name
+		results = measure(params, b.build)
+		ubench.PrintResultString(params, results)
+	}
+}
@@ -0,0 +1,218 @@
+package filter
+
+import (
+	"math"
+
+	"hack.systems/util/bloom"
+)
+
+const (
+	cuckooBucketSize = 4
+	cuckooMaxKicks   = 500
+	cuckooLoad       = 0.95
+)
+
+// Cuckoo is a cuckoo filter (Fan, Andersen, Kaminsky, and Mitzenmacher) that
+// supports deletion.  Each key is reduced to a fingerprint stored in one of
+// two candidate buckets of four slots; fingerprints are packed 8, 16, or 32
+// bits wide into 64-bit words.
+//
+// An Add that cannot find room after relocating fingerprints still succeeds:
+// the fingerprint it displaced last is parked aside as a victim and the
+// filter is marked full.  Every later Add returns false, but no key is ever
+// lost.
+//
+// Construct a filter with NewCuckoo.  It is not safe for concurrent use.
+type Cuckoo struct {
+	width   uint
+	mask    uint64
+	words   []uint64
+	count   uint64
+	victim  uint64
+	vbucket uint64
+	full    bool
+	rng     uint64
+}
+
+// NewCuckoo returns a filter sized to hold N items with false-positive
+// probability at most P, choosing the narrowest fingerprint that meets P.
+func NewCuckoo(N uint64, P float64) *Cuckoo {
+	if P <= 0 || P >= 1 {
+		panic("filter: false-positive probability must be in (0, 1)")
+	}
+	width := uint(8)
+	for width < 32 && 2*cuckooBucketSize/math.Exp2(float64(width)) > P {
+		width *= 2
+	}
+	buckets := uint64(1)
+	for float64(buckets*cuckooBucketSize)*cuckooLoad < float64(N) {
+		buckets *= 2
+	}
+	bits := buckets * cuckooBucketSize * uint64(width)
+	return &Cuckoo{
+		width: width,
+		mask:  buckets - 1,
+		words: make([]uint64, (bits+63)/64),
+		rng:   0x9e3779b97f4a7c15,
+	}
+}
+
+// Add inserts key and returns true, or returns false if an earlier Add
+// filled the filter.
+func (c *Cuckoo) Add(key string) bool {
+	return c.AddHash(bloom.Hash(key))
+}
+
+func (c *Cuckoo) AddHash(h uint64) bool {
+	if c.full {
+		return false
+	}
+	fp, i1, i2 := c.locate(h)
+	if c.insert(i1, fp) || c.insert(i2, fp) {
+		c.count++
+		return true
+	}
+	i := i1
+	if c.random()&1 == 1 {
+		i = i2
+	}
+	for n := 0; n < cuckooMaxKicks; n++ {
+		slot := i*cuckooBucketSize + c.random()%cuckooBucketSize
+		fp = c.swap(slot, fp)
+		i = c.alternate(i, fp)
+		if c.insert(i, fp) {
+			c.count++
+			return true
+		}
+	}
+	// The fingerprint displaced last has nowhere to go.  Keep it aside so
+	// that its key still tests positive, and refuse further inserts.
+	c.victim = fp
+	c.vbucket = i
+	c.full = true
+	c.count++
+	return true
+}
+
+// Delete removes one copy of key and returns true, or returns false if the
+// key's fingerprint is not present.  Deleting a key that was never added
+// may remove a colliding key's fingerprint.
+func (c *Cuckoo) Delete(key string) bool {
+	return c.DeleteHash(bloom.Hash(key))
+}
+
+func (c *Cuckoo) DeleteHash(h uint64) bool {
+	fp, i1, i2 := c.locate(h)
+	if c.remove(i1, fp) || c.remove(i2, fp) {
+		c.count--
+		if c.full {
+			// make room for the victim
+			c.full = false
+			if c.insert(c.vbucket, c.victim) || c.insert(c.alternate(c.vbucket, c.victim), c.victim) {
+				return true
+			}
+			c.full = true
+		}
+		return true
+	}
+	if c.full && fp == c.victim && (i1 == c.vbucket || i2 == c.vbucket) {
+		c.full = false
+		c.count--
+		return true
+	}
+	return false
+}
+
+func (c *Cuckoo) MayContain(key string) bool {
+	return c.MayContainHash(bloom.Hash(key))
+}
+
+func (c *Cuckoo) MayContainHash(h uint64) bool {
+	fp, i1, i2 := c.locate(h)
+	if c.full && fp == c.victim && (i1 == c.vbucket || i2 == c.vbucket) {
+		return true
+	}
+	return c.find(i1, fp) || c.find(i2, fp)
+}
+
+// Len returns the number of fingerprints stored.
+func (c *Cuckoo) Len() uint64 {
+	return c.count
+}
+
+func (c *Cuckoo) Bits() uint64 {
+	return uint64(len(c.words)) * 64
+}
+
+// locate returns the key's fingerprint, which is never zero so that zero can
+// mark an empty slot, and its two candidate buckets.
+func (c *Cuckoo) locate(h uint64) (uint64, uint64, uint64) {
+	h = mix(h)
+	fp := (h >> 32) & (1<<c.width - 1)
+	if fp == 0 {
+		fp = 1
+	}
+	i1 := h & c.mask
+	return fp, i1, c.alternate(i1, fp)
+}
+
+func (c *Cuckoo) alternate(i, fp uint64) uint64 {
+	return (i ^ mix(fp)) & c.mask
+}
+
+func (c *Cuckoo) insert(i, fp uint64) bool {
+	for s := i * cuckooBucketSize; s < (i+1)*cuckooBucketSize; s++ {
+		if c.get(s) == 0 {
+			c.set(s, fp)
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Cuckoo) remove(i, fp uint64) bool {
+	for s := i * cuckooBucketSize; s < (i+1)*cuckooBucketSize; s++ {
+		if c.get(s) == fp {
+			c.set(s, 0)
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Cuckoo) find(i, fp uint64) bool {
+	for s := i * cuckooBucketSize; s < (i+1)*cuckooBucketSize; s++ {
+		if c.get(s) == fp {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Cuckoo) swap(slot, fp uint64) uint64 {
+	old := c.get(slot)
+	c.set(slot, fp)
+	return old
+}
+
+func (c *Cuckoo) get(slot uint64) uint64 {
+	per := 64 / uint64(c.width)
+	shift := (slot % per) * uint64(c.width)
+	return (c.words[slot/per] >> shift) & (1<<c.width - 1)
+}
+
+func (c *Cuckoo) set(slot, fp uint64) {
+	per := 64 / uint64(c.width)
+	shift := (slot % per) * uint64(c.width)
+	w := &c.words[slot/per]
+	*w = *w&^((1<<c.width-1)<<shift) | fp<<shift
+}
+
+// random is a xorshift64 generator; victims need not be chosen well, only
+// not pathologically.
+func (c *Cuckoo) random() uint64 {
+	c.rng ^= c.rng << 13
+	c.rng ^= c.rng >> 7
+	c.rng ^= c.rng << 17
+	return c.rng
+}
@@ -0,0 +1,39 @@
+// Package filter collects approximate set-membership structures behind a
+// common interface so they can be chosen per use case.  The Bloom filters in
+// package bloom satisfy Filter, and every structure here places keys using
+// bloom.Hash so that a key hashed once may be probed against any of them.
+package filter
+
+import (
+	"hack.systems/util/bloom"
+)
+
+// Filter answers membership queries with no false negatives and a bounded
+// rate of false positives.
+type Filter interface {
+	MayContain(key string) bool
+	MayContainHash(h uint64) bool
+	// Bits is the size of the structure's table, for comparing space
+	// efficiency.
+	Bits() uint64
+}
+
+var (
+	_ Filter = (*bloom.Filter)(nil)
+	_ Filter = (*bloom.Blocked)(nil)
+	_ Filter = (*bloom.Concurrent)(nil)
+	_ Filter = (*bloom.Counting)(nil)
+	_ Filter = (*bloom.Scalable)(nil)
+	_ Filter = (*Cuckoo)(nil)
+	_ Filter = (*Xor)(nil)
+)
+
+// mix is the SplitMix64 finalizer.
+func mix(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
@@ -0,0 +1,109 @@
+package filter_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"hack.systems/util/bloom"
+	"hack.systems/util/filter"
+)
+
+func falsePositives(f filter.Filter, probes int) float64 {
+	fp := 0
+	for i := 0; i < probes; i++ {
+		if f.MayContain(fmt.Sprintf("absent-%d", i)) {
+			fp++
+		}
+	}
+	return float64(fp) / float64(probes)
+}
+
+func TestCuckoo(t *testing.T) {
+	require := require.New(t)
+
+	c := filter.NewCuckoo(10000, 0.001)
+	for i := 0; i < 10000; i++ {
+		require.True(c.Add(fmt.Sprintf("key-%d", i)))
+	}
+	require.Equal(uint64(10000), c.Len())
+	for i := 0; i < 10000; i++ {
+		require.True(c.MayContain(fmt.Sprintf("key-%d", i)))
+	}
+	require.True(falsePositives(c, 100000) < 0.001)
+	for i := 0; i < 10000; i += 2 {
+		require.True(c.Delete(fmt.Sprintf("key-%d", i)))
+	}
+	require.Equal(uint64(5000), c.Len())
+	for i := 1; i < 10000; i += 2 {
+		require.True(c.MayContain(fmt.Sprintf("key-%d", i)))
+	}
+	present := 0
+	for i := 0; i < 10000; i += 2 {
+		if c.MayContain(fmt.Sprintf("key-%d", i)) {
+			present++
+		}
+	}
+	require.True(present < 10)
+}
+
+func TestCuckooFull(t *testing.T) {
+	require := require.New(t)
+
+	c := filter.NewCuckoo(100, 0.01)
+	added := 0
+	for i := 0; i < 1000; i++ {
+		if c.Add(fmt.Sprintf("key-%d", i)) {
+			added++
+		}
+	}
+	require.True(added < 1000)
+	for i := 0; i < added; i++ {
+		require.True(c.MayContain(fmt.Sprintf("key-%d", i)))
+	}
+}
+
+func TestCuckooSmall(t *testing.T) {
+	require := require.New(t)
+
+	for n := uint64(0); n < 8; n++ {
+		c := filter.NewCuckoo(n, 0.1)
+		for i := uint64(0); i < n; i++ {
+			require.True(c.Add(fmt.Sprintf("key-%d", i)))
+		}
+		for i := uint64(0); i < n; i++ {
+			require.True(c.MayContain(fmt.Sprintf("key-%d", i)))
+		}
+	}
+}
+
+func TestXor(t *testing.T) {
+	require := require.New(t)
+
+	keys := make([]string, 0, 10001)
+	for i := 0; i < 10000; i++ {
+		keys = append(keys, fmt.Sprintf("key-%d", i))
+	}
+	keys = append(keys, "key-0")
+	x := filter.NewXor(keys)
+	for _, k := range keys {
+		require.True(x.MayContain(k))
+	}
+	require.InDelta(1.0/256, falsePositives(x, 100000), 0.002)
+	require.True(float64(x.Bits())/10000 < 10)
+}
+
+func TestInterface(t *testing.T) {
+	require := require.New(t)
+
+	b := bloom.New(1000, 0.01)
+	b.Add("hello")
+	c := filter.NewCuckoo(1000, 0.01)
+	c.Add("hello")
+	x := filter.NewXor([]string{"hello"})
+	for _, f := range []filter.Filter{b, c, x} {
+		require.True(f.MayContain("hello"))
+		require.True(f.MayContainHash(bloom.Hash("hello")))
+	}
+}
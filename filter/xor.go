@@ -0,0 +1,144 @@
+package filter
+
+import (
+	"math/bits"
+	"sort"
+
+	"hack.systems/util/bloom"
+)
+
+// Xor is a static xor filter (Graf and Lemire) with 8-bit fingerprints.  It
+// is built once from a fixed key set and uses about 9.84 bits per key for a
+// false-positive probability of about 1/256, less space than a Bloom filter
+// at the same error.
+//
+// Construct a filter with NewXor or NewXorHashes.  It is safe for concurrent
+// use once built.
+type Xor struct {
+	seed         uint64
+	blockLength  uint32
+	fingerprints []uint8
+}
+
+type xorSet struct {
+	mask  uint64
+	count uint32
+}
+
+func NewXor(keys []string) *Xor {
+	hashes := make([]uint64, len(keys))
+	for i, k := range keys {
+		hashes[i] = bloom.Hash(k)
+	}
+	return NewXorHashes(hashes)
+}
+
+// NewXorHashes builds a filter from keys already hashed with bloom.Hash.
+// Duplicate hashes are permitted.  The slice's contents are overwritten.
+func NewXorHashes(hashes []uint64) *Xor {
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+	uniq := hashes[:0]
+	for i, h := range hashes {
+		if i == 0 || h != hashes[i-1] {
+			uniq = append(uniq, h)
+		}
+	}
+	hashes = uniq
+	capacity := 32 + uint32(1.23*float64(len(hashes)))
+	capacity = capacity / 3 * 3
+	x := &Xor{
+		seed:         0x9e3779b97f4a7c15,
+		blockLength:  capacity / 3,
+		fingerprints: make([]uint8, capacity),
+	}
+	sets := make([]xorSet, capacity)
+	queue := make([]uint32, 0, capacity)
+	type entry struct {
+		hash  uint64
+		index uint32
+	}
+	stack := make([]entry, 0, len(hashes))
+	for {
+		for i := range sets {
+			sets[i] = xorSet{}
+		}
+		for _, h := range hashes {
+			hash := mix(h + x.seed)
+			for _, i := range x.indices(hash) {
+				sets[i].mask ^= hash
+				sets[i].count++
+			}
+		}
+		queue = queue[:0]
+		for i := range sets {
+			if sets[i].count == 1 {
+				queue = append(queue, uint32(i))
+			}
+		}
+		stack = stack[:0]
+		for len(queue) > 0 {
+			i := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			if sets[i].count != 1 {
+				continue
+			}
+			hash := sets[i].mask
+			stack = append(stack, entry{hash, i})
+			for _, j := range x.indices(hash) {
+				sets[j].mask ^= hash
+				sets[j].count--
+				if sets[j].count == 1 {
+					queue = append(queue, j)
+				}
+			}
+		}
+		if len(stack) == len(hashes) {
+			break
+		}
+		// the hypergraph has a cycle; reseed and try again
+		x.seed = mix(x.seed)
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		e := stack[i]
+		idx := x.indices(e.hash)
+		x.fingerprints[e.index] = fingerprint(e.hash) ^
+			x.fingerprints[idx[0]] ^
+			x.fingerprints[idx[1]] ^
+			x.fingerprints[idx[2]]
+	}
+	return x
+}
+
+func (x *Xor) MayContain(key string) bool {
+	return x.MayContainHash(bloom.Hash(key))
+}
+
+func (x *Xor) MayContainHash(h uint64) bool {
+	hash := mix(h + x.seed)
+	idx := x.indices(hash)
+	return fingerprint(hash) == x.fingerprints[idx[0]]^
+		x.fingerprints[idx[1]]^
+		x.fingerprints[idx[2]]
+}
+
+func (x *Xor) Bits() uint64 {
+	return uint64(len(x.fingerprints)) * 8
+}
+
+// indices maps a hash to one slot in each third of the table.
+func (x *Xor) indices(hash uint64) [3]uint32 {
+	return [3]uint32{
+		reduce(uint32(hash), x.blockLength),
+		reduce(uint32(bits.RotateLeft64(hash, 21)), x.blockLength) + x.blockLength,
+		reduce(uint32(bits.RotateLeft64(hash, 42)), x.blockLength) + 2*x.blockLength,
+	}
+}
+
+func fingerprint(hash uint64) uint8 {
+	return uint8(hash ^ hash>>32)
+}
+
+// reduce maps x uniformly onto [0, n) without a division.
+func reduce(x, n uint32) uint32 {
+	return uint32((uint64(x) * uint64(n)) >> 32)
+}
@@ -0,0 +1,228 @@
+package ubench
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sweep is the flags of a parameter struct where each flag takes a list of
+// values to sweep.  A list separates values with commas, and a comma within
+// a value is written \,.  A numeric value may be a range start:stop:step that
+// counts from start to at most stop by step, or by a factor when step is
+// written xN.  For example, --cache-size=1e4:1e6:x10 sweeps 1e4, 1e5, and
+// 1e6.
+type Sweep struct {
+	params reflect.Value
+	fields []*sweepValue
+}
+
+// AddSweepToFlagSet adds a flag to f for each tagged field of the struct
+// ptr points to, as AddToFlagSet does, but taking lists of values.
+func AddSweepToFlagSet(f *flag.FlagSet, ptr interface{}) *Sweep {
+	V := reflect.ValueOf(ptr).Elem()
+	T := V.Type()
+	S := &Sweep{params: V}
+	for i := 0; i < T.NumField(); i++ {
+		field := T.Field(i)
+		if len(string(field.Tag)) == 0 {
+			continue
+		}
+		switch V.Field(i).Interface().(type) {
+		case bool, time.Duration, float64, int, int64, string, uint, uint64:
+		default:
+			panic("unknown parameter type")
+		}
+		v := &sweepValue{index: i, field: V.Field(i)}
+		S.fields = append(S.fields, v)
+		f.Var(v, FieldNameToFlag(field.Name), string(field.Tag))
+	}
+	return S
+}
+
+// AddSweepFlags adds sweep flags for ptr to the command line.
+func AddSweepFlags(ptr interface{}) *Sweep {
+	return AddSweepToFlagSet(flag.CommandLine, ptr)
+}
+
+// Expand returns a copy of the parameters for each combination of swept
+// values, in order with the first field varying slowest.  Fields whose
+// flags were not set keep the value they hold at the time of the call.
+func (S *Sweep) Expand() []interface{} {
+	runs := []reflect.Value{S.params}
+	for _, f := range S.fields {
+		if f.values == nil {
+			continue
+		}
+		var next []reflect.Value
+		for _, run := range runs {
+			for _, v := range f.values {
+				c := reflect.New(run.Type()).Elem()
+				c.Set(run)
+				c.Field(f.index).Set(v)
+				next = append(next, c)
+			}
+		}
+		runs = next
+	}
+	params := make([]interface{}, len(runs))
+	for i := range runs {
+		params[i] = runs[i].Interface()
+	}
+	return params
+}
+
+// sweepValue is the flag.Value of one field of a Sweep.
+type sweepValue struct {
+	index  int
+	field  reflect.Value
+	raw    string
+	values []reflect.Value
+}
+
+func (v *sweepValue) String() string {
+	switch {
+	case v == nil || !v.field.IsValid():
+		return ""
+	case v.values != nil:
+		return v.raw
+	default:
+		return fmt.Sprintf("%v", v.field.Interface())
+	}
+}
+
+func (v *sweepValue) IsBoolFlag() bool {
+	return v.field.Kind() == reflect.Bool
+}
+
+func (v *sweepValue) Set(s string) error {
+	var values []reflect.Value
+	for _, item := range splitList(s) {
+		vs, err := v.parse(strings.TrimSpace(item))
+		if err != nil {
+			return err
+		}
+		values = append(values, vs...)
+	}
+	v.raw = s
+	v.values = values
+	return nil
+}
+
+// splitList splits a list at the commas not escaped by a backslash, and
+// unescapes those that are.
+func splitList(s string) []string {
+	var items []string
+	var item strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == ',':
+			item.WriteByte(',')
+			i++
+		case s[i] == ',':
+			items = append(items, item.String())
+			item.Reset()
+		default:
+			item.WriteByte(s[i])
+		}
+	}
+	return append(items, item.String())
+}
+
+// parse returns the values of one item of a list.
+func (v *sweepValue) parse(item string) ([]reflect.Value, error) {
+	T := v.field.Type()
+	switch v.field.Interface().(type) {
+	case bool:
+		b, err := strconv.ParseBool(item)
+		if err != nil {
+			return nil, err
+		}
+		return []reflect.Value{reflect.ValueOf(b).Convert(T)}, nil
+	case time.Duration:
+		d, err := time.ParseDuration(item)
+		if err != nil {
+			return nil, err
+		}
+		return []reflect.Value{reflect.ValueOf(d).Convert(T)}, nil
+	case string:
+		return []reflect.Value{reflect.ValueOf(item).Convert(T)}, nil
+	}
+	xs, err := sweepRange(item)
+	if err != nil {
+		return nil, err
+	}
+	var values []reflect.Value
+	for _, x := range xs {
+		switch T.Kind() {
+		case reflect.Float64:
+			values = append(values, reflect.ValueOf(x).Convert(T))
+		case reflect.Int, reflect.Int64:
+			r := math.Round(x)
+			if r != x || r < math.MinInt64 || r >= math.MaxInt64 || reflect.Zero(T).OverflowInt(int64(r)) {
+				return nil, fmt.Errorf("%v is not a valid %v", x, T)
+			}
+			values = append(values, reflect.ValueOf(int64(r)).Convert(T))
+		case reflect.Uint, reflect.Uint64:
+			r := math.Round(x)
+			if r != x || r < 0 || r >= math.MaxUint64 || reflect.Zero(T).OverflowUint(uint64(r)) {
+				return nil, fmt.Errorf("%v is not a valid %v", x, T)
+			}
+			values = append(values, reflect.ValueOf(uint64(r)).Convert(T))
+		}
+	}
+	return values, nil
+}
+
+// sweepRange returns the numbers of a number or a range start:stop:step.
+func sweepRange(item string) ([]float64, error) {
+	parts := strings.Split(item, ":")
+	if len(parts) == 1 {
+		x, err := strconv.ParseFloat(item, 64)
+		if err != nil {
+			return nil, err
+		}
+		return []float64{x}, nil
+	}
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("range %q is not start:stop:step", item)
+	}
+	start, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return nil, err
+	}
+	stop, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return nil, err
+	}
+	factor := strings.HasPrefix(parts[2], "x")
+	step, err := strconv.ParseFloat(strings.TrimPrefix(parts[2], "x"), 64)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case start > stop:
+		return nil, fmt.Errorf("range %q counts down", item)
+	case factor && (start <= 0 || step <= 1):
+		return nil, fmt.Errorf("range %q does not grow", item)
+	case !factor && step <= 0:
+		return nil, fmt.Errorf("range %q does not grow", item)
+	}
+	// tolerate rounding in reaching stop, so that 0.1:0.3:0.1 ends at 0.3
+	limit := stop + 1e-9*math.Max(math.Abs(start), math.Abs(stop))
+	var xs []float64
+	for i := 0; ; i++ {
+		x := start + float64(i)*step
+		if factor {
+			x = start * math.Pow(step, float64(i))
+		}
+		if x > limit {
+			return xs, nil
+		}
+		xs = append(xs, math.Min(x, stop))
+	}
+}
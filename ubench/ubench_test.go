@@ -1,6 +1,8 @@
 package ubench_test
 
 import (
+	"flag"
+	"io"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -44,3 +46,58 @@ func TestFieldNamesToFlags(t *testing.T) {
 	require.Equal("zipf-theta", ubench.FieldNameToFlag("ZipfTheta"))
 	require.Equal("http-requests", ubench.FieldNameToFlag("HTTPRequests"))
 }
+
+type SweepParameters struct {
+	Algorithm string  `algorithm`
+	Size      uint64  `size`
+	Ratio     float64 `ratio`
+	Fast      bool    `fast`
+	Seed      int
+}
+
+func TestSweep(t *testing.T) {
+	require := require.New(t)
+	params := SweepParameters{Algorithm: "LRU", Size: 5, Seed: 42}
+	f := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	S := ubench.AddSweepToFlagSet(f, &params)
+	require.NoError(f.Parse([]string{"--algorithm=LRU,ARC", "--size=1e4:1e6:x10", "--fast"}))
+	runs := S.Expand()
+	require.Len(runs, 6)
+	require.Equal(SweepParameters{Algorithm: "LRU", Size: 1e4, Fast: true, Seed: 42}, runs[0])
+	require.Equal(SweepParameters{Algorithm: "LRU", Size: 1e6, Fast: true, Seed: 42}, runs[2])
+	require.Equal(SweepParameters{Algorithm: "ARC", Size: 1e5, Fast: true, Seed: 42}, runs[4])
+	require.Equal(SweepParameters{Algorithm: "LRU", Size: 5, Seed: 42}, params)
+
+	require.NoError(f.Parse([]string{`--algorithm=a\,b, c`, "--size=1"}))
+	runs = S.Expand()
+	require.Len(runs, 2)
+	require.Equal("a,b", runs[0].(SweepParameters).Algorithm)
+	require.Equal("c", runs[1].(SweepParameters).Algorithm)
+}
+
+func TestSweepRanges(t *testing.T) {
+	require := require.New(t)
+	var params SweepParameters
+	f := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	f.SetOutput(io.Discard)
+	S := ubench.AddSweepToFlagSet(f, &params)
+	require.NoError(f.Parse([]string{"--size=1:10:3,20", "--ratio=0.1:0.3:0.1"}))
+	var sizes []uint64
+	var ratios []float64
+	for _, run := range S.Expand() {
+		p := run.(SweepParameters)
+		if p.Ratio == 0.1 {
+			sizes = append(sizes, p.Size)
+		}
+		if p.Size == 1 {
+			ratios = append(ratios, p.Ratio)
+		}
+	}
+	require.Equal([]uint64{1, 4, 7, 10, 20}, sizes)
+	require.Equal([]float64{0.1, 0.2, 0.3}, ratios)
+	require.Error(f.Parse([]string{"--size=1.5"}))
+	require.Error(f.Parse([]string{"--size=-1"}))
+	require.Error(f.Parse([]string{"--size=10:1:1"}))
+	require.Error(f.Parse([]string{"--size=1:10:x1"}))
+	require.Error(f.Parse([]string{"--size=1:10"}))
+}